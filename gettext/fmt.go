@@ -8,9 +8,89 @@ import (
 	"bytes"
 	"fmt"
 	"strconv"
+	"strings"
 	"unicode"
 )
 
+// Formatter formats translations using the given arguments.
+//
+// A Formatter can be set in a Catalog to replace the default printf-style
+// formatting, e.g., to support named placeholders or ICU-style messages.
+type Formatter interface {
+	Format(s string, a ...interface{}) string
+}
+
+// FormatterFunc is an adapter to use an ordinary function as a Formatter.
+type FormatterFunc func(s string, a ...interface{}) string
+
+// Format calls f(s, a...).
+func (f FormatterFunc) Format(s string, a ...interface{}) string {
+	return f(s, a...)
+}
+
+// NamedFormatter is a Formatter that supports named placeholders. When the
+// only argument is a map[string]interface{}, translations are formatted
+// using FormatNamed; otherwise they are formatted printf-style, as messages
+// do by default. To use it, set it in a catalog:
+//
+//	c.Formatter = gettext.NamedFormatter
+//	c.Get("{count} files in {dir}", map[string]interface{}{
+//		"count": 3,
+//		"dir":   "/tmp",
+//	})
+var NamedFormatter = FormatterFunc(formatNamed)
+
+// formatNamed formats a string using FormatNamed if the only argument is
+// a map of named arguments, or formatPrintf otherwise.
+func formatNamed(s string, a ...interface{}) string {
+	if len(a) == 1 {
+		if args, ok := a[0].(map[string]interface{}); ok {
+			return FormatNamed(s, args)
+		}
+	}
+	return formatPrintf(s, a...)
+}
+
+// FormatNamed replaces named placeholders like "{name}" in a string by the
+// corresponding argument, formatted using fmt.Sprint(). Placeholders without
+// an argument are left intact. Literal braces are escaped by doubling them:
+// "{{" and "}}" result in "{" and "}".
+func FormatNamed(s string, args map[string]interface{}) string {
+	buf := new(bytes.Buffer)
+	end := len(s)
+	for i := 0; i < end; i++ {
+		c := s[i]
+		switch {
+		case (c == '{' || c == '}') && i+1 < end && s[i+1] == c:
+			// escaped brace
+			buf.WriteByte(c)
+			i++
+		case c == '{':
+			j := strings.IndexByte(s[i+1:], '}')
+			if j == -1 {
+				buf.WriteString(s[i:])
+				return buf.String()
+			}
+			if v, ok := args[s[i+1:i+1+j]]; ok {
+				fmt.Fprint(buf, v)
+			} else {
+				buf.WriteString(s[i : i+2+j])
+			}
+			i += j + 1
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+// formatPrintf formats a string using fmt.Sprintf(), supporting arguments
+// reordering as in "%2$d bytes on %1$s.".
+func formatPrintf(s string, a ...interface{}) string {
+	format, order := parseFmt(s, "")
+	return sprintf(format, order, a...)
+}
+
 // parseFmt converts a string that relies on reordering ability to a standard
 // format, e.g., the string "%2$d bytes on %1$s." becomes "%d bytes on %s.".
 // The returned indices are used to format the resulting string using
@@ -63,11 +143,12 @@ func sprintf(format string, order []int, a ...interface{}) string {
 	if order == nil {
 		return fmt.Sprintf(format, a...)
 	}
+	// Positions are 1-based.
 	b := make([]interface{}, len(order))
 	l := len(a)
 	for k, v := range order {
-		if v < l {
-			b[k] = a[v]
+		if v > 0 && v <= l {
+			b[k] = a[v-1]
 		}
 	}
 	return fmt.Sprintf(format, b...)
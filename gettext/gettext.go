@@ -7,7 +7,9 @@ package gettext
 import (
 	"errors"
 	"fmt"
+	"mime"
 	"sort"
+	"sync"
 
 	"code.google.com/p/sadbox/gettext/pluralforms"
 )
@@ -32,42 +34,172 @@ func NewCatalog() *Catalog {
 
 // Catalog stores gettext translations.
 //
-// Catalog messages can't be modified in-place; they must be removed and
-// re-added using Add() after the modifications, because they message key
-// depends on the content of the message.
+// Catalog messages can't be modified in-place; they must be removed using
+// Remove() and re-added using Add() after the modifications, because they
+// message key depends on the content of the message.
+//
+// Catalog methods are safe for concurrent use. Accessing the exported fields
+// directly is not, so they should be set before the catalog is shared.
+// Requests that use different contexts should use GetC and GetPluralC
+// instead of switching the active context with SetContext.
 type Catalog struct {
-	Header     map[string]string      // meta-data
-	Messages   map[Key]Message        // translations
-	PluralFunc pluralforms.PluralFunc // used to select the plural form index
-	ctx        string                 // active context
-	hasCtx     bool                   // whether to use a context
+	Domain          string                 // text domain
+	Header          map[string]string      // meta-data
+	Messages        map[Key]Message        // translations
+	Obsolete        []Message              // obsolete translations, kept in PO files
+	PluralFunc      pluralforms.PluralFunc // used to select the plural form index
+	ContextFallback bool                   // use messages without context if missing
+	Formatter       Formatter              // formats translations; if nil, messages format themselves
+	ctx             string                 // active context
+	hasCtx          bool                   // whether to use a context
+	mu              sync.RWMutex           // guards Messages and the active context
 }
 
 // Add adds a message to the catalog.
 func (c *Catalog) Add(msg Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.Messages[msg.Key()] = msg
 }
 
+// Remove removes the message for the given key, using the active context.
+// It doesn't fall back to the message without context: only a message
+// stored for the active context is removed.
+func (c *Catalog) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.Messages, c.key(key))
+}
+
+// Has returns true if the catalog has a translation for the given key,
+// using the active context. Context fallback works as in Get.
+func (c *Catalog) Has(key string) bool {
+	_, ok := c.lookup(key)
+	return ok
+}
+
+// Len returns the number of messages in the catalog.
+func (c *Catalog) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.Messages)
+}
+
+// Range calls fn for each message in the catalog, sorted by key. Messages
+// without context come first. If fn returns false the iteration stops.
+//
+// The catalog is not locked while fn is called, so fn can modify it.
+func (c *Catalog) Range(fn func(Message) bool) {
+	for _, msg := range sortedMessages(c) {
+		if !fn(msg) {
+			return
+		}
+	}
+}
+
 // Clone returns a copy of the catalog.
 func (c *Catalog) Clone() *Catalog {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	clone := NewCatalog()
+	clone.Domain = c.Domain
 	clone.PluralFunc = c.PluralFunc
+	clone.ContextFallback = c.ContextFallback
+	clone.Formatter = c.Formatter
 	clone.ctx = c.ctx
 	clone.hasCtx = c.hasCtx
+	for k, v := range c.Header {
+		clone.Header[k] = v
+	}
 	for k, v := range c.Messages {
 		clone.Messages[k] = v.Clone()
 	}
+	for _, v := range c.Obsolete {
+		clone.Obsolete = append(clone.Obsolete, v.Clone())
+	}
 	return clone
 }
 
+// Merge copies the messages and header entries from another catalog.
+//
+// Existing messages and header entries are only replaced if overwrite is
+// true. The plural function follows the Plural-Forms header: it is copied
+// along with the header, or if the catalog doesn't have one.
+func (c *Catalog) Merge(other *Catalog, overwrite bool) {
+	if other == c {
+		return
+	}
+	// Copy the other messages first to avoid holding both locks.
+	other.mu.RLock()
+	msgs := make(map[Key]Message, len(other.Messages))
+	for k, v := range other.Messages {
+		msgs[k] = v
+	}
+	other.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, v := range msgs {
+		if _, ok := c.Messages[k]; !ok || overwrite {
+			c.Messages[k] = v.Clone()
+		}
+	}
+	pluralForms := false
+	for k, v := range other.Header {
+		if _, ok := c.Header[k]; !ok || overwrite {
+			c.Header[k] = v
+			pluralForms = pluralForms || k == "plural-forms"
+		}
+	}
+	if (pluralForms || c.PluralFunc == nil) && other.PluralFunc != nil {
+		c.PluralFunc = other.PluralFunc
+	}
+}
+
+// Language returns the language of the translations, as declared in the
+// Language header entry, or an empty string if it is not set.
+func (c *Catalog) Language() string {
+	return c.Header["language"]
+}
+
+// Charset returns the charset declared in the Content-Type header entry,
+// or an empty string if it is not set or the header is malformed.
+func (c *Catalog) Charset() string {
+	charset, _ := c.charset()
+	return charset
+}
+
+// charset returns the charset declared in the Content-Type header entry.
+// It returns an error if the header is malformed.
+func (c *Catalog) charset() (string, error) {
+	header, ok := c.Header["content-type"]
+	if !ok {
+		return "", nil
+	}
+	_, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		return "", fmt.Errorf("Malformed Content-Type header: %q", header)
+	}
+	return params["charset"], nil
+}
+
+// PluralForms returns the Plural-Forms header entry, or an empty string if
+// it is not set.
+func (c *Catalog) PluralForms() string {
+	return c.Header["plural-forms"]
+}
+
 // SetContext activates a given context for messages.
 func (c *Catalog) SetContext(ctx string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.ctx = ctx
 	c.hasCtx = true
 }
 
 // RemoveContext deactivates any context for messages.
 func (c *Catalog) RemoveContext() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.ctx = ""
 	c.hasCtx = false
 }
@@ -75,13 +207,16 @@ func (c *Catalog) RemoveContext() {
 // Get returns a translation for the given key, or an empty string if the
 // key is not found.
 //
+// If a context is active and ContextFallback is set, the translation
+// without context is used when there's none for the context.
+//
 // Extra arguments or optional, used to format the translation.
 func (c *Catalog) Get(key string, a ...interface{}) string {
-	if msg, ok := c.Messages[Key{Src: key, Ctx: c.ctx, HasCtx: c.hasCtx}]; ok {
+	if msg, ok := c.lookup(key); ok {
 		if a == nil {
 			return msg.Get()
 		}
-		return msg.Format(msg.Get(), a...)
+		return c.format(msg, msg.Get(), a...)
 	}
 	return ""
 }
@@ -89,19 +224,151 @@ func (c *Catalog) Get(key string, a ...interface{}) string {
 // GetPlural returns a plural translation for the given key and number,
 // or an empty string if the key is not found.
 //
+// Context fallback works as in Get.
+//
 // Extra arguments or optional, used to format the translation.
 func (c *Catalog) GetPlural(key string, num int, a ...interface{}) string {
-	if msg, ok := c.Messages[Key{Src: key, Ctx: c.ctx, HasCtx: c.hasCtx}]; ok {
+	if msg, ok := c.lookup(key); ok {
+		if a == nil {
+			return msg.GetPlural(c.PluralFunc(num))
+		}
+		return c.format(msg, msg.GetPlural(c.PluralFunc(num)), a...)
+	}
+	return ""
+}
+
+// GetOrKey returns a translation for the given key like Get, or the key
+// itself if there's no translation, so that untranslated messages display
+// the source text like gettext does.
+//
+// Extra arguments or optional, used to format the translation or the key.
+func (c *Catalog) GetOrKey(key string, a ...interface{}) string {
+	if s := c.Get(key, a...); s != "" {
+		return s
+	}
+	return c.formatKey(key, a...)
+}
+
+// GetPluralOrKey returns a plural translation for the given key and number
+// like GetPlural, or the key itself if there's no translation.
+//
+// Extra arguments or optional, used to format the translation or the key.
+func (c *Catalog) GetPluralOrKey(key string, num int, a ...interface{}) string {
+	if s := c.GetPlural(key, num, a...); s != "" {
+		return s
+	}
+	return c.formatKey(key, a...)
+}
+
+// formatKey formats an untranslated key using the catalog formatter, or
+// printf-style if the catalog doesn't have one.
+func (c *Catalog) formatKey(key string, a ...interface{}) string {
+	if a == nil {
+		return key
+	}
+	if c.Formatter != nil {
+		return c.Formatter.Format(key, a...)
+	}
+	return formatPrintf(key, a...)
+}
+
+// NGet returns a plural translation for the given number, formatted with
+// the number as the only argument, as in the common ngettext idiom:
+//
+//	c.NGet("%d file", "%d files", n)
+//
+// The singular form is used as key. If the key is not found, the singular
+// form is used when the number is 1 and the plural form otherwise, like
+// ngettext does.
+func (c *Catalog) NGet(singular, plural string, num int) string {
+	if s := c.GetPlural(singular, num, num); s != "" {
+		return s
+	}
+	return ngetSource(singular, plural, num)
+}
+
+// ngetSource returns the untranslated source for NGet.
+func ngetSource(singular, plural string, num int) string {
+	if num == 1 {
+		return formatPrintf(singular, num)
+	}
+	return formatPrintf(plural, num)
+}
+
+// GetC returns a translation for the given context and key, or an empty
+// string if the key is not found.
+//
+// It works like Get with the given context active, but doesn't change the
+// active context of the catalog, so it is safe for concurrent use.
+func (c *Catalog) GetC(ctx, key string, a ...interface{}) string {
+	if msg, ok := c.lookupKey(Key{Src: key, Ctx: ctx, HasCtx: true}); ok {
+		if a == nil {
+			return msg.Get()
+		}
+		return c.format(msg, msg.Get(), a...)
+	}
+	return ""
+}
+
+// GetPluralC returns a plural translation for the given context, key and
+// number, or an empty string if the key is not found.
+//
+// It works like GetPlural with the given context active, but doesn't change
+// the active context of the catalog, so it is safe for concurrent use.
+func (c *Catalog) GetPluralC(ctx, key string, num int, a ...interface{}) string {
+	if msg, ok := c.lookupKey(Key{Src: key, Ctx: ctx, HasCtx: true}); ok {
 		if a == nil {
 			return msg.GetPlural(c.PluralFunc(num))
 		}
-		return msg.Format(msg.GetPlural(c.PluralFunc(num)), a...)
+		return c.format(msg, msg.GetPlural(c.PluralFunc(num)), a...)
 	}
 	return ""
 }
 
+// format formats a translation using the catalog formatter, or the message
+// formatter if the catalog doesn't have one.
+func (c *Catalog) format(msg Message, s string, a ...interface{}) string {
+	if c.Formatter != nil {
+		return c.Formatter.Format(s, a...)
+	}
+	return msg.Format(s, a...)
+}
+
+// key returns the message key for the given source, using the active
+// context. The caller must hold the lock.
+func (c *Catalog) key(src string) Key {
+	return Key{Src: src, Ctx: c.ctx, HasCtx: c.hasCtx}
+}
+
+// lookup returns the message for the given source, using the active
+// context and falling back to no context if enabled.
+func (c *Catalog) lookup(src string) (Message, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lookupKeyLocked(c.key(src))
+}
+
+// lookupKey returns the message for the given key, falling back to no
+// context if enabled.
+func (c *Catalog) lookupKey(k Key) (Message, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lookupKeyLocked(k)
+}
+
+// lookupKeyLocked is like lookupKey, but the caller must hold the lock.
+func (c *Catalog) lookupKeyLocked(k Key) (Message, bool) {
+	msg, ok := c.Messages[k]
+	if !ok && k.HasCtx && c.ContextFallback {
+		msg, ok = c.Messages[Key{Src: k.Src}]
+	}
+	return msg, ok
+}
+
 // sortedMessages returns a slice of messages sorted by key for a catalog.
 func sortedMessages(c *Catalog) []Message {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	var msgs []Message
 	keyMap := make(map[string][]Message)
 	for k, v := range c.Messages {
@@ -136,6 +403,101 @@ func sortedMessageKeys(m map[string][]Message) []string {
 	return keys
 }
 
+// Diff compares two catalogs. It returns the keys of messages only in b
+// (added), only in a (removed) and in both but with different translations
+// (changed). Keys are sorted like messages in PO files.
+func Diff(a, b *Catalog) (added, removed, changed []Key) {
+	msgsA, msgsB := sortedMessages(a), sortedMessages(b)
+	mapA := make(map[Key]Message, len(msgsA))
+	for _, msg := range msgsA {
+		mapA[msg.Key()] = msg
+	}
+	mapB := make(map[Key]Message, len(msgsB))
+	for _, msg := range msgsB {
+		mapB[msg.Key()] = msg
+	}
+	for _, msg := range msgsA {
+		k := msg.Key()
+		if other, ok := mapB[k]; !ok {
+			removed = append(removed, k)
+		} else if !equalTranslations(msg, other) {
+			changed = append(changed, k)
+		}
+	}
+	for _, msg := range msgsB {
+		if _, ok := mapA[msg.Key()]; !ok {
+			added = append(added, msg.Key())
+		}
+	}
+	return
+}
+
+// equalTranslations returns true if two messages have the same translations.
+func equalTranslations(m1, m2 Message) bool {
+	switch t1 := m1.(type) {
+	case *SimpleMessage:
+		t2, ok := m2.(*SimpleMessage)
+		return ok && t1.Dst == t2.Dst
+	case *PluralMessage:
+		t2, ok := m2.(*PluralMessage)
+		if !ok || len(t1.Dst) != len(t2.Dst) {
+			return false
+		}
+		for k, v := range t1.Dst {
+			if v != t2.Dst[k] {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// ----------------------------------------------------------------------------
+
+// NewCatalogSet returns a new CatalogSet, initializing internal fields.
+func NewCatalogSet() *CatalogSet {
+	return &CatalogSet{Catalogs: make(map[string]*Catalog)}
+}
+
+// CatalogSet stores catalogs for multiple text domains.
+type CatalogSet struct {
+	Catalogs map[string]*Catalog // catalogs by domain
+}
+
+// Add adds a catalog to the set, using the catalog domain as key.
+func (s *CatalogSet) Add(c *Catalog) {
+	s.Catalogs[c.Domain] = c
+}
+
+// Catalog returns the catalog for the given domain, or nil if the domain
+// is not found.
+func (s *CatalogSet) Catalog(domain string) *Catalog {
+	return s.Catalogs[domain]
+}
+
+// GetD returns a translation for the given domain and key, or an empty
+// string if the domain or key is not found.
+//
+// Extra arguments or optional, used to format the translation.
+func (s *CatalogSet) GetD(domain, key string, a ...interface{}) string {
+	if c, ok := s.Catalogs[domain]; ok {
+		return c.Get(key, a...)
+	}
+	return ""
+}
+
+// GetPluralD returns a plural translation for the given domain, key and
+// number, or an empty string if the domain or key is not found.
+//
+// Extra arguments or optional, used to format the translation.
+func (s *CatalogSet) GetPluralD(domain, key string, num int, a ...interface{}) string {
+	if c, ok := s.Catalogs[domain]; ok {
+		return c.GetPlural(key, num, a...)
+	}
+	return ""
+}
+
 // ----------------------------------------------------------------------------
 
 // Message represents a translation, including meta-data.
@@ -199,6 +561,16 @@ func (m *MessageInfo) Clone() *MessageInfo {
 	return clone
 }
 
+// isFuzzy returns true if the message is flagged as "fuzzy".
+func isFuzzy(msg Message) bool {
+	for _, flag := range msg.Info().Flags {
+		if flag == "fuzzy" {
+			return true
+		}
+	}
+	return false
+}
+
 // ----------------------------------------------------------------------------
 
 // SimpleMessage is a message without plural forms.
@@ -235,8 +607,7 @@ func (m *SimpleMessage) GetPlural(idx int) string {
 }
 
 func (m *SimpleMessage) Format(s string, a ...interface{}) string {
-	// TODO: use message formatter
-	return fmt.Sprintf(s, a...)
+	return formatPrintf(s, a...)
 }
 
 func (m *SimpleMessage) Clone() Message {
@@ -302,8 +673,7 @@ func (m *PluralMessage) GetPlural(index int) string {
 }
 
 func (m *PluralMessage) Format(s string, a ...interface{}) string {
-	// TODO: use message formatter
-	return fmt.Sprintf(s, a...)
+	return formatPrintf(s, a...)
 }
 
 func (m *PluralMessage) Clone() Message {
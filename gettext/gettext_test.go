@@ -9,8 +9,14 @@ import (
 	"encoding/base64"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"runtime"
+	"sync"
 	"testing"
+	"testing/fstest"
+
+	"code.google.com/p/sadbox/gettext/pluralforms"
 )
 
 func decode(value []byte) ([]byte, error) {
@@ -84,6 +90,26 @@ func TestReadMo(t *testing.T) {
 	equalString(c.GetPlural("There is %s file", 2), "Hay %s ficheros")
 }
 
+func TestReadMoBytes(t *testing.T) {
+	b, err := decode([]byte(gnuMoData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCatalog()
+	if err := new(MoReader).ReadBytes(c, b); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Get("mullusk"); got != "bacon" {
+		t.Errorf("Expected %q, got %q.", "bacon", got)
+	}
+	if got := c.GetPlural("There is %s file", 2); got != "Hay %s ficheros" {
+		t.Errorf("Expected %q, got %q.", "Hay %s ficheros", got)
+	}
+	if err := new(MoReader).ReadBytes(NewCatalog(), []byte("bad")); err == nil {
+		t.Errorf("Expected error for malformed data.")
+	}
+}
+
 func TestWriteMo(t *testing.T) {
 	equalString := func(s1, s2 string) {
 		if s1 != s2 {
@@ -221,3 +247,923 @@ func TestContext(t *testing.T) {
 	f2.Close()
 	testCatalog(c2)
 }
+
+func TestWritePo(t *testing.T) {
+	c := NewCatalog()
+	c.Header["language"] = "pt_BR"
+	c.Header["plural-forms"] = "nplurals=2; plural=n != 1;"
+	c.Add(&SimpleMessage{Src: "foo", Dst: "bar"})
+	m := &SimpleMessage{Src: "food", Dst: "merenda", Ctx: "kids", HasCtx: true}
+	m.Info().UserComments = []string{"translator comment"}
+	m.Info().SourceComments = []string{"extracted comment"}
+	m.Info().References = []string{"main.go:42"}
+	m.Info().Flags = []string{"fuzzy", "c-format"}
+	m.Info().PrevSingular = "fod"
+	c.Add(m)
+	c.Add(&PluralMessage{
+		Src: []string{"bubble", "bubbles"},
+		Dst: []string{"bolha", "bolhas"},
+	})
+	c.Add(&SimpleMessage{
+		Src: "This is a \"long\" message that doesn't fit in a single line of a PO file, so it is wrapped.",
+		Dst: "Line one\nLine two",
+	})
+
+	expected := `msgid ""
+msgstr ""
+"Language: pt_BR\n"
+"Plural-Forms: nplurals=2; plural=n != 1;\n"
+
+msgid ""
+"This is a \"long\" message that doesn't fit in a single line of a PO file, "
+"so it is wrapped."
+msgstr ""
+"Line one\n"
+"Line two"
+
+msgid "bubble"
+msgid_plural "bubbles"
+msgstr[0] "bolha"
+msgstr[1] "bolhas"
+
+msgid "foo"
+msgstr "bar"
+
+# translator comment
+#. extracted comment
+#: main.go:42
+#, fuzzy, c-format
+#| msgid "fod"
+msgctxt "kids"
+msgid "food"
+msgstr "merenda"
+`
+	b := new(bytes.Buffer)
+	pw := new(PoWriter)
+	if err := pw.Write(c, b); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+}
+
+func TestReadPo(t *testing.T) {
+	equalString := func(s1, s2 string) {
+		if s1 != s2 {
+			t.Errorf("Expected %q, got %q.", s2, s1)
+		}
+	}
+
+	data := `msgid ""
+msgstr ""
+"Language: pt_BR\n"
+"Plural-Forms: nplurals=2; plural=n != 1;\n"
+
+msgid ""
+"This is a \"long\" message that doesn't fit in a single line of a PO file, "
+"so it is wrapped."
+msgstr ""
+"Line one\n"
+"Line two"
+
+msgid "bubble"
+msgid_plural "bubbles"
+msgstr[0] "bolha"
+msgstr[1] "bolhas"
+
+# translator comment
+#. extracted comment
+#: main.go:42
+#, fuzzy, c-format
+#| msgid "fod"
+msgctxt "kids"
+msgid "food"
+msgstr "merenda"
+
+# revived some day
+#~ msgid "mullusk"
+#~ msgstr "bacon"
+`
+	c := NewCatalog()
+	if err := new(PoReader).Read(c, bytes.NewReader([]byte(data))); err != nil {
+		t.Fatal(err)
+	}
+	equalString(c.Language(), "pt_BR")
+	equalString(c.Get("This is a \"long\" message that doesn't fit in a single line of a PO file, so it is wrapped."), "Line one\nLine two")
+	equalString(c.GetPlural("bubble", 1), "bolha")
+	equalString(c.GetPlural("bubble", 2), "bolhas")
+	equalString(c.GetC("kids", "food"), "merenda")
+	// Obsolete messages are not used.
+	equalString(c.Get("mullusk"), "")
+	if len(c.Obsolete) != 1 {
+		t.Fatalf("Expected 1 obsolete message, got %d.", len(c.Obsolete))
+	}
+	equalString(c.Obsolete[0].Get(), "bacon")
+
+	b := new(bytes.Buffer)
+	if err := new(PoWriter).Write(c, b); err != nil {
+		t.Fatal(err)
+	}
+	equalString(b.String(), data)
+
+	c = NewCatalog()
+	pr := &PoReader{SkipFuzzy: true}
+	if err := pr.Read(c, bytes.NewReader([]byte(data))); err != nil {
+		t.Fatal(err)
+	}
+	equalString(c.GetC("kids", "food"), "")
+	equalString(c.GetPlural("bubble", 2), "bolhas")
+
+	for _, data := range []string{
+		"msgid \"foo\"\nmsgstr \"bar",
+		"msgid \"foo\"\nmsgstr[x] \"bar\"",
+		"msgid \"foo\"\nmsgfoo \"bar\"",
+		"\"foo\"",
+	} {
+		if err := new(PoReader).Read(NewCatalog(), bytes.NewReader([]byte(data))); err == nil {
+			t.Errorf("Expected error for %q.", data)
+		}
+	}
+}
+
+func TestParseComments(t *testing.T) {
+	info := ParseComments([]string{
+		"# translator comment",
+		"#",
+		"#. extracted comment",
+		"#: main.go:42 util.go:7",
+		"#: other.go:1",
+		"#, fuzzy, c-format",
+		"#| msgctxt \"kids\"",
+		"#| msgid \"\"",
+		"#| \"a long \"",
+		"#| \"message\"",
+		"#| msgid_plural \"long messages\"",
+		"#~ msgid \"obsolete\"",
+		"#| malformed",
+		"msgid \"foo\"",
+	})
+	expected := &MessageInfo{
+		UserComments:   []string{"translator comment", ""},
+		SourceComments: []string{"extracted comment"},
+		References:     []string{"main.go:42", "util.go:7", "other.go:1"},
+		Flags:          []string{"fuzzy", "c-format"},
+		PrevSingular:   "a long message",
+		PrevPlural:     "long messages",
+		PrevCtx:        "kids",
+		HasPrevCtx:     true,
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("Expected %+v, got %+v.", expected, info)
+	}
+	if info := ParseComments(nil); !reflect.DeepEqual(info, &MessageInfo{}) {
+		t.Errorf("Expected empty info, got %+v.", info)
+	}
+}
+
+func TestReadMoCharset(t *testing.T) {
+	equalString := func(s1, s2 string) {
+		if s1 != s2 {
+			t.Errorf("Expected %q, got %q.", s2, s1)
+		}
+	}
+
+	mr := new(MoReader)
+	mw := new(MoWriter)
+
+	// Strings are encoded in latin-1.
+	c := NewCatalog()
+	c.Header["content-type"] = "text/plain; charset=iso-8859-1"
+	c.Add(&SimpleMessage{Src: "apple", Dst: "ma\xe7\xe3"})
+	c.Add(&SimpleMessage{Src: "caf\xe9", Dst: "caf\xe9zinho"})
+
+	f1 := newFile("testReadMoCharset", t)
+	if err := mw.Write(c, f1); err != nil {
+		t.Fatal(err)
+	}
+	f1.Close()
+
+	f2, err := os.Open(f1.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2 := NewCatalog()
+	if err := mr.Read(c2, f2); err != nil {
+		t.Fatal(err)
+	}
+	f2.Close()
+
+	equalString(c2.Get("apple"), "maçã")
+	equalString(c2.Get("café"), "cafézinho")
+
+	// Unknown charsets are rejected.
+	c.Header["content-type"] = "text/plain; charset=foo-42"
+	f1 = newFile("testReadMoCharset", t)
+	if err := mw.Write(c, f1); err != nil {
+		t.Fatal(err)
+	}
+	f1.Close()
+
+	f2, err = os.Open(f1.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mr.Read(NewCatalog(), f2); err == nil {
+		t.Errorf("Expected error for unknown charset.")
+	}
+	f2.Close()
+}
+
+func TestMerge(t *testing.T) {
+	equalString := func(s1, s2 string) {
+		if s1 != s2 {
+			t.Errorf("Expected %q, got %q.", s2, s1)
+		}
+	}
+
+	newBase := func() *Catalog {
+		c := NewCatalog()
+		c.PluralFunc = nil
+		c.Header["language"] = "pt"
+		c.Add(&SimpleMessage{Src: "food", Dst: "comida"})
+		c.Add(&SimpleMessage{Src: "bus", Dst: "autocarro"})
+		return c
+	}
+	regional := NewCatalog()
+	regional.Header["language"] = "pt_BR"
+	regional.Header["plural-forms"] = "nplurals=2; plural=n>1;"
+	regional.PluralFunc = func(n int) int { return 42 }
+	regional.Add(&SimpleMessage{Src: "bus", Dst: "ônibus"})
+	regional.Add(&SimpleMessage{Src: "food", Dst: "rango", Ctx: "slang", HasCtx: true})
+
+	c := newBase()
+	c.Merge(regional, false)
+	equalString(c.Get("food"), "comida")
+	equalString(c.Get("bus"), "autocarro")
+	equalString(c.Header["language"], "pt")
+	equalString(c.Header["plural-forms"], "nplurals=2; plural=n>1;")
+	c.SetContext("slang")
+	equalString(c.Get("food"), "rango")
+	if c.PluralFunc == nil || c.PluralFunc(1) != 42 {
+		t.Errorf("Expected plural func to be copied.")
+	}
+
+	c = newBase()
+	c.PluralFunc = func(n int) int { return 7 }
+	c.Merge(regional, true)
+	equalString(c.Get("food"), "comida")
+	equalString(c.Get("bus"), "ônibus")
+	equalString(c.Header["language"], "pt_BR")
+	if c.PluralFunc(1) != 42 {
+		t.Errorf("Expected plural func to follow the plural-forms header.")
+	}
+
+	// A catalog without plural-forms keeps its plural func.
+	c = newBase()
+	c.PluralFunc = func(n int) int { return 7 }
+	c.Merge(NewCatalog(), true)
+	if c.PluralFunc(1) != 7 {
+		t.Errorf("Expected plural func to be kept.")
+	}
+}
+
+func TestMergePluralForms(t *testing.T) {
+	newCatalog := func(forms string) *Catalog {
+		_, fn, err := pluralforms.ParseForms(forms)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := NewCatalog()
+		c.Header["plural-forms"] = forms
+		c.PluralFunc = fn
+		c.Add(&PluralMessage{
+			Src: []string{"bubble", "bubbles"},
+			Dst: []string{"bolha", "bolhas"},
+		})
+		return c
+	}
+	for _, test := range []struct {
+		overwrite bool
+		expected  string
+	}{
+		{false, "bolhas"},
+		{true, "bolha"},
+	} {
+		c := newCatalog("nplurals=2; plural=n != 1;")
+		c.Merge(newCatalog("nplurals=2; plural=n>1;"), test.overwrite)
+		if s := c.GetPlural("bubble", 0); s != test.expected {
+			t.Errorf("overwrite=%v: expected %q, got %q.", test.overwrite, test.expected, s)
+		}
+	}
+}
+
+func TestRemoveHas(t *testing.T) {
+	c := NewCatalog()
+	c.Add(&SimpleMessage{Src: "food", Dst: "comida"})
+	c.Add(&SimpleMessage{Src: "food", Dst: "merenda", Ctx: "kids", HasCtx: true})
+	c.Add(&SimpleMessage{Src: "food", Dst: "rango", Ctx: "slang", HasCtx: true})
+
+	if !c.Has("food") {
+		t.Errorf("Expected message without context.")
+	}
+	if c.Has("music") {
+		t.Errorf("Unexpected message %q.", "music")
+	}
+
+	// Remove a message only from the active context.
+	c.SetContext("kids")
+	if !c.Has("food") {
+		t.Errorf("Expected message with context %q.", "kids")
+	}
+	c.Remove("food")
+	if c.Has("food") {
+		t.Errorf("Expected message with context %q to be removed.", "kids")
+	}
+	c.SetContext("slang")
+	if !c.Has("food") {
+		t.Errorf("Expected message with context %q.", "slang")
+	}
+	c.RemoveContext()
+	if !c.Has("food") {
+		t.Errorf("Expected message without context.")
+	}
+	c.Remove("food")
+	if c.Has("food") {
+		t.Errorf("Expected message without context to be removed.")
+	}
+	if len(c.Messages) != 1 {
+		t.Errorf("Expected 1 message, got %d.", len(c.Messages))
+	}
+}
+
+func TestLenRange(t *testing.T) {
+	c := NewCatalog()
+	c.Add(&SimpleMessage{Src: "music", Dst: "música"})
+	c.Add(&SimpleMessage{Src: "food", Dst: "rango", Ctx: "slang", HasCtx: true})
+	c.Add(&SimpleMessage{Src: "food", Dst: "comida"})
+	c.Add(&SimpleMessage{Src: "food", Dst: "merenda", Ctx: "kids", HasCtx: true})
+
+	if c.Len() != 4 {
+		t.Errorf("Expected 4 messages, got %d.", c.Len())
+	}
+
+	var got []string
+	c.Range(func(msg Message) bool {
+		got = append(got, msg.Get())
+		return true
+	})
+	expected := []string{"comida", "merenda", "rango", "música"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v.", expected, got)
+	}
+
+	got = nil
+	c.Range(func(msg Message) bool {
+		got = append(got, msg.Get())
+		return len(got) < 2
+	})
+	if !reflect.DeepEqual(got, expected[:2]) {
+		t.Errorf("Expected %v, got %v.", expected[:2], got)
+	}
+}
+
+func TestReadMoNPlurals(t *testing.T) {
+	mr := new(MoReader)
+	mw := new(MoWriter)
+
+	c := NewCatalog()
+	c.Header["plural-forms"] = "nplurals=3; plural=n==1 ? 0 : n==2 ? 1 : 2;"
+	c.Add(&PluralMessage{
+		Src: []string{"bubble", "bubbles"},
+		Dst: []string{"bolha", "bolhas"},
+	})
+
+	f1 := newFile("testReadMoNPlurals", t)
+	if err := mw.Write(c, f1); err != nil {
+		t.Fatal(err)
+	}
+	f1.Close()
+
+	f2, err := os.Open(f1.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f2.Close()
+	if err := mr.Read(NewCatalog(), f2); err == nil {
+		t.Errorf("Expected error for missing plural form.")
+	}
+}
+
+func TestCatalogSet(t *testing.T) {
+	equalString := func(s1, s2 string) {
+		if s1 != s2 {
+			t.Errorf("Expected %q, got %q.", s2, s1)
+		}
+	}
+
+	app := NewCatalog()
+	app.Domain = "app"
+	app.Add(&SimpleMessage{Src: "Open", Dst: "Abrir"})
+	app.Add(&PluralMessage{
+		Src: []string{"%d file", "%d files"},
+		Dst: []string{"%d arquivo", "%d arquivos"},
+	})
+	lib := NewCatalog()
+	lib.Domain = "lib"
+	lib.Add(&SimpleMessage{Src: "Open", Dst: "Aberto"})
+
+	s := NewCatalogSet()
+	s.Add(app)
+	s.Add(lib)
+
+	equalString(s.GetD("app", "Open"), "Abrir")
+	equalString(s.GetD("lib", "Open"), "Aberto")
+	equalString(s.GetD("other", "Open"), "")
+	equalString(s.GetPluralD("app", "%d file", 2, 2), "2 arquivos")
+	equalString(s.GetPluralD("lib", "%d file", 2, 2), "")
+	equalString(s.GetPluralD("other", "%d file", 2, 2), "")
+	if s.Catalog("app") != app {
+		t.Errorf("Expected catalog for domain %q.", "app")
+	}
+}
+
+func TestLoadLocale(t *testing.T) {
+	b, err := decode([]byte(gnuMoData))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "_Go_testLoadLocale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "es", "LC_MESSAGES"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "es", "LC_MESSAGES", "messages.mo")
+	if err := ioutil.WriteFile(name, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"es/LC_MESSAGES/messages.mo": &fstest.MapFile{Data: b},
+	}
+
+	testCatalog := func(c *Catalog, err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Domain != "messages" {
+			t.Errorf("Expected domain %q, got %q.", "messages", c.Domain)
+		}
+		if s := c.Get("mullusk"); s != "bacon" {
+			t.Errorf("Expected %q, got %q.", "bacon", s)
+		}
+	}
+	testCatalog(LoadLocale(dir, "es", "messages"))
+	testCatalog(LoadLocaleFS(fsys, "es", "messages"))
+
+	if _, err := LoadLocale(dir, "fr", "messages"); err == nil {
+		t.Errorf("Expected error for missing locale.")
+	}
+	if _, err := LoadLocaleFS(fsys, "es", "other"); err == nil {
+		t.Errorf("Expected error for missing domain.")
+	}
+}
+
+func TestContextFallback(t *testing.T) {
+	equalString := func(s1, s2 string) {
+		if s1 != s2 {
+			t.Errorf("Expected %q, got %q.", s2, s1)
+		}
+	}
+
+	c := NewCatalog()
+	c.Add(&SimpleMessage{Src: "food", Dst: "comida"})
+	c.Add(&SimpleMessage{Src: "music", Dst: "melodia", Ctx: "kids", HasCtx: true})
+	c.Add(&PluralMessage{
+		Src: []string{"bubble", "bubbles"},
+		Dst: []string{"bolha", "bolhas"},
+	})
+
+	c.SetContext("kids")
+	equalString(c.Get("food"), "")
+	equalString(c.GetPlural("bubble", 2), "")
+
+	if c.Has("food") {
+		t.Errorf("Expected no translation for %q without fallback.", "food")
+	}
+
+	c.ContextFallback = true
+	equalString(c.Get("food"), "comida")
+	equalString(c.Get("music"), "melodia")
+	equalString(c.GetPlural("bubble", 2), "bolhas")
+	if !c.Has("food") || !c.Has("bubble") {
+		t.Errorf("Expected Has to fall back to messages without context.")
+	}
+
+	// Remove doesn't fall back.
+	c.Remove("food")
+	equalString(c.Get("food"), "comida")
+
+	c.RemoveContext()
+	equalString(c.Get("music"), "")
+}
+
+func TestGetC(t *testing.T) {
+	equalString := func(s1, s2 string) {
+		if s1 != s2 {
+			t.Errorf("Expected %q, got %q.", s2, s1)
+		}
+	}
+
+	c := NewCatalog()
+	c.Add(&SimpleMessage{Src: "food", Dst: "comida"})
+	c.Add(&SimpleMessage{Src: "food", Dst: "rango", Ctx: "slang", HasCtx: true})
+	c.Add(&SimpleMessage{Src: "%d kids", Dst: "%d crianças", Ctx: "kids", HasCtx: true})
+	c.Add(&PluralMessage{
+		Src:    []string{"bubble", "bubbles"},
+		Dst:    []string{"bolha", "bolhas"},
+		Ctx:    "kids",
+		HasCtx: true,
+	})
+
+	c.SetContext("kids")
+	equalString(c.GetC("slang", "food"), "rango")
+	equalString(c.GetC("kids", "%d kids", 3), "3 crianças")
+	equalString(c.GetC("kids", "food"), "")
+	equalString(c.GetPluralC("kids", "bubble", 1), "bolha")
+	equalString(c.GetPluralC("kids", "bubble", 2), "bolhas")
+	equalString(c.GetPluralC("slang", "bubble", 2), "")
+	// The active context is not changed.
+	equalString(c.Get("food"), "")
+	equalString(c.GetPlural("bubble", 2), "bolhas")
+
+	c.ContextFallback = true
+	equalString(c.GetC("kids", "food"), "comida")
+	c.RemoveContext()
+	equalString(c.GetC("slang", "food"), "rango")
+	equalString(c.Get("food"), "comida")
+}
+
+func TestFormat(t *testing.T) {
+	equalString := func(s1, s2 string) {
+		if s1 != s2 {
+			t.Errorf("Expected %q, got %q.", s2, s1)
+		}
+	}
+
+	c := NewCatalog()
+	c.Add(&SimpleMessage{Src: "%s: %d files", Dst: "%2$d files on %1$s"})
+	c.Add(&SimpleMessage{Src: "%d%% done", Dst: "%d%% feito"})
+	c.Add(&PluralMessage{
+		Src: []string{"%s: %d file", "%s: %d files"},
+		Dst: []string{"%2$d arquivo em %1$s", "%2$d arquivos em %1$s"},
+	})
+
+	equalString(c.Get("%s: %d files", "/tmp", 3), "3 files on /tmp")
+	equalString(c.Get("%d%% done", 50), "50% feito")
+	equalString(c.GetPlural("%s: %d file", 1, "/tmp", 1), "1 arquivo em /tmp")
+	equalString(c.GetPlural("%s: %d file", 2, "/tmp", 2), "2 arquivos em /tmp")
+
+	c.Formatter = FormatterFunc(func(s string, a ...interface{}) string {
+		return "[" + s + "]"
+	})
+	equalString(c.Get("%s: %d files", "/tmp", 3), "[%2$d files on %1$s]")
+	equalString(c.Clone().GetPlural("%s: %d file", 2, "/tmp", 2), "[%2$d arquivos em %1$s]")
+}
+
+func TestFormatNamed(t *testing.T) {
+	args := map[string]interface{}{"count": 3, "dir": "/tmp"}
+	tests := []struct {
+		s        string
+		expected string
+	}{
+		{"{count} files in {dir}", "3 files in /tmp"},
+		{"{dir}: {count}", "/tmp: 3"},
+		{"{count} files in {missing}", "3 files in {missing}"},
+		{"{{count}} is {count}", "{count} is 3"},
+		{"}} {{ {count}}}", "} { 3}"},
+		{"unclosed {count", "unclosed {count"},
+		{"{}", "{}"},
+		{"no placeholders", "no placeholders"},
+	}
+	for _, test := range tests {
+		if got := FormatNamed(test.s, args); got != test.expected {
+			t.Errorf("Expected %q, got %q.", test.expected, got)
+		}
+	}
+
+	c := NewCatalog()
+	c.Formatter = NamedFormatter
+	c.Add(&SimpleMessage{Src: "{count} files in {dir}", Dst: "{count} arquivos em {dir}"})
+	c.Add(&SimpleMessage{Src: "%s: %d files", Dst: "%2$d arquivos em %1$s"})
+	if got := c.Get("{count} files in {dir}", args); got != "3 arquivos em /tmp" {
+		t.Errorf("Expected %q, got %q.", "3 arquivos em /tmp", got)
+	}
+	if got := c.Get("%s: %d files", "/tmp", 3); got != "3 arquivos em /tmp" {
+		t.Errorf("Expected %q, got %q.", "3 arquivos em /tmp", got)
+	}
+}
+
+// TestConcurrentGet is meant to be run with -race.
+func TestConcurrentGet(t *testing.T) {
+	c := NewCatalog()
+	c.Add(&SimpleMessage{Src: "food", Dst: "comida"})
+	c.Add(&SimpleMessage{Src: "food", Dst: "merenda", Ctx: "kids", HasCtx: true})
+	c.Add(&SimpleMessage{Src: "food", Dst: "rango", Ctx: "slang", HasCtx: true})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if j%2 == 0 {
+					c.SetContext("kids")
+				} else {
+					c.RemoveContext()
+				}
+				c.Add(&SimpleMessage{Src: "music", Dst: "música"})
+				c.Has("food")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if s := c.Get("food"); s != "comida" && s != "merenda" {
+					t.Errorf("Unexpected translation %q.", s)
+				}
+				if s := c.GetC("slang", "food"); s != "rango" {
+					t.Errorf("Expected %q, got %q.", "rango", s)
+				}
+				c.Len()
+				c.Clone()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestJSON(t *testing.T) {
+	b, err := decode([]byte(gnuMoData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCatalog()
+	if err := new(MoReader).Read(c, bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	c.Add(&SimpleMessage{Src: "food", Dst: "merenda", Ctx: "kids", HasCtx: true})
+	c.Add(&PluralMessage{
+		Src:    []string{"bubble", "bubbles"},
+		Dst:    []string{"bolha", "bolhas"},
+		Ctx:    "",
+		HasCtx: true,
+	})
+
+	buf := new(bytes.Buffer)
+	if err := new(JSONWriter).Write(c, buf); err != nil {
+		t.Fatal(err)
+	}
+	c2 := NewCatalog()
+	if err := new(JSONReader).Read(c2, bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.Header, c2.Header) {
+		t.Errorf("Expected header %v, got %v.", c.Header, c2.Header)
+	}
+	if c.Len() != c2.Len() {
+		t.Errorf("Expected %d messages, got %d.", c.Len(), c2.Len())
+	}
+	// get returns the translation for a key using the catalog methods.
+	get := func(c *Catalog, k Key, plural bool, n int) string {
+		switch {
+		case plural && k.HasCtx:
+			return c.GetPluralC(k.Ctx, k.Src, n)
+		case plural:
+			return c.GetPlural(k.Src, n)
+		case k.HasCtx:
+			return c.GetC(k.Ctx, k.Src)
+		}
+		return c.Get(k.Src)
+	}
+	c.Range(func(msg Message) bool {
+		_, plural := msg.(*PluralMessage)
+		for _, n := range []int{1, 2} {
+			expected, got := get(c, msg.Key(), plural, n), get(c2, msg.Key(), plural, n)
+			if got != expected {
+				t.Errorf("Expected %q, got %q.", expected, got)
+			}
+		}
+		return true
+	})
+
+	// Writing again gives the same result.
+	buf2 := new(bytes.Buffer)
+	if err := new(JSONWriter).Write(c2, buf2); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != buf2.String() {
+		t.Errorf("Expected %s, got %s.", buf, buf2)
+	}
+
+	err = new(JSONReader).Read(NewCatalog(), bytes.NewReader([]byte(
+		`{"messages": [{"msgid": "foo", "msgstr": 1}]}`)))
+	if err == nil {
+		t.Errorf("Expected error for invalid msgstr.")
+	}
+}
+
+func TestNGet(t *testing.T) {
+	equalString := func(s1, s2 string) {
+		if s1 != s2 {
+			t.Errorf("Expected %q, got %q.", s2, s1)
+		}
+	}
+
+	c := NewCatalog()
+	c.Add(&PluralMessage{
+		Src: []string{"%d file", "%d files"},
+		Dst: []string{"%d arquivo", "%d arquivos"},
+	})
+	equalString(c.NGet("%d file", "%d files", 1), "1 arquivo")
+	equalString(c.NGet("%d file", "%d files", 3), "3 arquivos")
+	equalString(c.NGet("%d dir", "%d dirs", 1), "1 dir")
+	equalString(c.NGet("%d dir", "%d dirs", 3), "3 dirs")
+}
+
+func TestHeaderAccessors(t *testing.T) {
+	equalString := func(s1, s2 string) {
+		if s1 != s2 {
+			t.Errorf("Expected %q, got %q.", s2, s1)
+		}
+	}
+
+	b, err := decode([]byte(gnuMoData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCatalog()
+	if err := new(MoReader).Read(c, bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	equalString(c.Language(), "")
+	equalString(c.Charset(), "iso-8859-1")
+	equalString(c.PluralForms(), "nplurals=2; plural=n!=1;")
+
+	// Clones have the same header, which is not shared.
+	clone := c.Clone()
+	equalString(clone.Charset(), "iso-8859-1")
+	equalString(clone.PluralForms(), "nplurals=2; plural=n!=1;")
+	clone.Header["language"] = "pt_BR"
+	equalString(c.Language(), "")
+
+	c = NewCatalog()
+	readMoHeader(c, "Language: pt_BR\nContent-Type: text/plain\n")
+	equalString(c.Language(), "pt_BR")
+	equalString(c.Charset(), "")
+	equalString(c.PluralForms(), "")
+	c.Header["content-type"] = "text/plain; charset"
+	equalString(c.Charset(), "")
+}
+
+func TestGetOrKey(t *testing.T) {
+	equalString := func(s1, s2 string) {
+		if s1 != s2 {
+			t.Errorf("Expected %q, got %q.", s2, s1)
+		}
+	}
+
+	c := NewCatalog()
+	c.Add(&SimpleMessage{Src: "food", Dst: "comida"})
+	c.Add(&PluralMessage{
+		Src: []string{"%d bubble", "%d bubbles"},
+		Dst: []string{"%d bolha", "%d bolhas"},
+	})
+	equalString(c.GetOrKey("food"), "comida")
+	equalString(c.GetOrKey("music"), "music")
+	equalString(c.GetOrKey("%d songs", 3), "3 songs")
+	equalString(c.GetPluralOrKey("%d bubble", 2, 2), "2 bolhas")
+	equalString(c.GetPluralOrKey("%d ball", 2, 2), "2 ball")
+	equalString(c.GetPluralOrKey("100%", 2), "100%")
+
+	c.Formatter = NamedFormatter
+	equalString(c.GetOrKey("{n} songs", map[string]interface{}{"n": 3}), "3 songs")
+}
+
+func TestDiff(t *testing.T) {
+	a := NewCatalog()
+	a.Add(&SimpleMessage{Src: "food", Dst: "comida"})
+	a.Add(&SimpleMessage{Src: "food", Dst: "merenda", Ctx: "kids", HasCtx: true})
+	a.Add(&SimpleMessage{Src: "music", Dst: "música"})
+	a.Add(&SimpleMessage{Src: "same", Dst: "igual"})
+	a.Add(&PluralMessage{
+		Src: []string{"bubble", "bubbles"},
+		Dst: []string{"bolha", "bolhas"},
+	})
+	a.Add(&PluralMessage{
+		Src: []string{"file", "files"},
+		Dst: []string{"arquivo", "arquivos"},
+	})
+
+	b := a.Clone()
+	b.Add(&SimpleMessage{Src: "drink", Dst: "bebida"})
+	b.Add(&SimpleMessage{Src: "food", Dst: "lanche", Ctx: "kids", HasCtx: true})
+	b.Remove("music")
+	b.Add(&PluralMessage{
+		Src: []string{"bubble", "bubbles"},
+		Dst: []string{"bolha", "bolhinhas"},
+	})
+	b.Add(&SimpleMessage{Src: "file", Dst: "arquivo"})
+	b.Add(&SimpleMessage{Src: "toy", Dst: "brinquedo", Ctx: "kids", HasCtx: true})
+
+	added, removed, changed := Diff(a, b)
+	expectedAdded := []Key{{Src: "drink"}, {Src: "toy", Ctx: "kids", HasCtx: true}}
+	expectedRemoved := []Key{{Src: "music"}}
+	expectedChanged := []Key{
+		{Src: "bubble"},
+		{Src: "file"},
+		{Src: "food", Ctx: "kids", HasCtx: true},
+	}
+	if !reflect.DeepEqual(added, expectedAdded) {
+		t.Errorf("Expected added %v, got %v.", expectedAdded, added)
+	}
+	if !reflect.DeepEqual(removed, expectedRemoved) {
+		t.Errorf("Expected removed %v, got %v.", expectedRemoved, removed)
+	}
+	if !reflect.DeepEqual(changed, expectedChanged) {
+		t.Errorf("Expected changed %v, got %v.", expectedChanged, changed)
+	}
+
+	added, removed, changed = Diff(a, a.Clone())
+	if added != nil || removed != nil || changed != nil {
+		t.Errorf("Expected no differences, got %v, %v, %v.", added, removed, changed)
+	}
+}
+
+func TestWriteMoHeader(t *testing.T) {
+	mr := new(MoReader)
+	mw := new(MoWriter)
+
+	header := map[string]string{
+		"language":     "pt_BR",
+		"content-type": "text/plain; charset=UTF-8",
+		"plural-forms": "nplurals=2; plural=n>1;",
+	}
+	c := NewCatalog()
+	for k, v := range header {
+		c.Header[k] = v
+	}
+	c.Add(&SimpleMessage{Src: "foo", Dst: "bar"})
+
+	f1 := newFile("testWriteMoHeader", t)
+	if err := mw.Write(c, f1); err != nil {
+		t.Fatal(err)
+	}
+	f1.Close()
+
+	f2, err := os.Open(f1.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2 := NewCatalog()
+	if err := mr.Read(c2, f2); err != nil {
+		t.Fatal(err)
+	}
+	f2.Close()
+	if !reflect.DeepEqual(c2.Header, header) {
+		t.Errorf("Expected header %v, got %v.", header, c2.Header)
+	}
+
+	// Output is reproducible.
+	expected := "Content-Type: text/plain; charset=UTF-8\n" +
+		"Language: pt_BR\n" +
+		"Plural-Forms: nplurals=2; plural=n>1;\n"
+	if s := writeHeader(c); s != expected {
+		t.Errorf("Expected %q, got %q.", expected, s)
+	}
+	c3 := NewCatalog()
+	readMoHeader(c3, expected)
+	if !reflect.DeepEqual(c3.Header, header) {
+		t.Errorf("Expected header %v, got %v.", header, c3.Header)
+	}
+}
+
+func TestCanonicalHeaderKey(t *testing.T) {
+	for k, v := range map[string]string{
+		"content-type":              "Content-Type",
+		"project-id-version":        "Project-Id-Version",
+		"report-msgid-bugs-to":      "Report-Msgid-Bugs-To",
+		"pot-creation-date":         "POT-Creation-Date",
+		"po-revision-date":          "PO-Revision-Date",
+		"mime-version":              "MIME-Version",
+		"content-transfer-encoding": "Content-Transfer-Encoding",
+		"x-generator":               "X-Generator",
+	} {
+		if s := canonicalHeaderKey(k); s != v {
+			t.Errorf("Expected %q, got %q.", v, s)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gettext
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"code.google.com/p/sadbox/gettext/pluralforms"
+)
+
+// jsonCatalog is the JSON representation of a catalog:
+//
+//	{
+//		"domain": "messages",
+//		"header": {"plural-forms": "nplurals=2; plural=n != 1;"},
+//		"messages": [
+//			{"msgid": "food", "msgstr": "comida"},
+//			{"msgctxt": "kids", "msgid": "food", "msgstr": "merenda"},
+//			{"msgid": "bubble", "msgid_plural": "bubbles",
+//			 "msgstr": ["bolha", "bolhas"]}
+//		]
+//	}
+//
+// Messages are sorted by key, as in PO files. Plural translations are
+// stored as arrays.
+type jsonCatalog struct {
+	Domain   string            `json:"domain,omitempty"`
+	Header   map[string]string `json:"header"`
+	Messages []jsonMessage     `json:"messages"`
+}
+
+type jsonMessage struct {
+	Ctx      *string         `json:"msgctxt,omitempty"`
+	ID       string          `json:"msgid"`
+	IDPlural string          `json:"msgid_plural,omitempty"`
+	Str      json.RawMessage `json:"msgstr"`
+}
+
+// JSONWriter writes catalogs as JSON, e.g., to ship translations to
+// JavaScript code.
+type JSONWriter struct {
+}
+
+// Write writes a catalog to the given writer.
+func (jw *JSONWriter) Write(c *Catalog, w io.Writer) error {
+	jc := jsonCatalog{
+		Domain:   c.Domain,
+		Header:   c.Header,
+		Messages: []jsonMessage{},
+	}
+	if jc.Header == nil {
+		jc.Header = map[string]string{}
+	}
+	for _, msg := range sortedMessages(c) {
+		var jm jsonMessage
+		var err error
+		if ctx, err := msg.Context(); err == nil {
+			jm.Ctx = &ctx
+		}
+		switch t := msg.(type) {
+		case *SimpleMessage:
+			jm.ID = t.Src
+			jm.Str, err = json.Marshal(t.Dst)
+		case *PluralMessage:
+			if len(t.Src) > 0 {
+				jm.ID = t.Src[0]
+			}
+			if len(t.Src) > 1 {
+				jm.IDPlural = t.Src[1]
+			}
+			dst := t.Dst
+			if dst == nil {
+				dst = []string{}
+			}
+			jm.Str, err = json.Marshal(dst)
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		jc.Messages = append(jc.Messages, jm)
+	}
+	return json.NewEncoder(w).Encode(jc)
+}
+
+// JSONReader loads catalogs written by JSONWriter.
+type JSONReader struct {
+}
+
+// Read loads a catalog from the given reader.
+func (jr *JSONReader) Read(c *Catalog, r io.Reader) error {
+	var jc jsonCatalog
+	if err := json.NewDecoder(r).Decode(&jc); err != nil {
+		return err
+	}
+	if jc.Domain != "" {
+		c.Domain = jc.Domain
+	}
+	for k, v := range jc.Header {
+		c.Header[k] = v
+	}
+	if header := c.PluralForms(); header != "" {
+		_, fn, err := pluralforms.ParseForms(header)
+		if err != nil {
+			return err
+		}
+		c.PluralFunc = fn
+	}
+	for _, jm := range jc.Messages {
+		var ctx string
+		if jm.Ctx != nil {
+			ctx = *jm.Ctx
+		}
+		var dst string
+		var dstPlural []string
+		if err := json.Unmarshal(jm.Str, &dst); err == nil {
+			c.Add(&SimpleMessage{
+				Src:    jm.ID,
+				Dst:    dst,
+				Ctx:    ctx,
+				HasCtx: jm.Ctx != nil,
+			})
+		} else if err := json.Unmarshal(jm.Str, &dstPlural); err == nil {
+			c.Add(&PluralMessage{
+				Src:    []string{jm.ID, jm.IDPlural},
+				Dst:    dstPlural,
+				Ctx:    ctx,
+				HasCtx: jm.Ctx != nil,
+			})
+		} else {
+			return fmt.Errorf("Message %q has an invalid msgstr: %s",
+				jm.ID, jm.Str)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gettext
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+)
+
+// LoadLocale loads a catalog from a GNU MO file stored following the
+// conventional layout:
+//
+//	dir/lang/LC_MESSAGES/domain.mo
+//
+// The catalog domain is set to the given domain.
+func LoadLocale(dir, lang, domain string) (*Catalog, error) {
+	return LoadLocaleFS(os.DirFS(dir), lang, domain)
+}
+
+// LoadLocaleFS is like LoadLocale but reads the MO file from the given file
+// system, e.g., one embedded in the program.
+func LoadLocaleFS(fsys fs.FS, lang, domain string) (*Catalog, error) {
+	name := path.Join(lang, "LC_MESSAGES", domain+".mo")
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("Locale file %q not found", name)
+		}
+		return nil, err
+	}
+	c := NewCatalog()
+	c.Domain = domain
+	if err := new(MoReader).Read(c, bytes.NewReader(b)); err != nil {
+		return nil, fmt.Errorf("Failed to read locale file %q: %s", name, err)
+	}
+	return c, nil
+}
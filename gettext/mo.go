@@ -10,9 +10,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/textproto"
+	"sort"
 	"strings"
 
 	"code.google.com/p/sadbox/gettext/pluralforms"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
 )
 
 const (
@@ -22,8 +27,13 @@ const (
 
 // MoReader loads catalogs from GNU MO files.
 //
-// Currently only UTF-8 encoding is supported. An encoding translator
-// may be added in the future.
+// Messages and translations are converted to UTF-8 using the charset
+// declared in the Content-Type header. If no charset is declared they
+// are assumed to be UTF-8.
+//
+// GNU MO files don't store flags, so fuzzy messages can't be told apart;
+// msgfmt leaves them out unless called with --use-fuzzy. Use PoReader with
+// SkipFuzzy to drop them when reading PO files.
 type MoReader struct {
 }
 
@@ -71,6 +81,8 @@ func (mr *MoReader) Read(c *Catalog, r io.ReadSeeker) error {
 	// Build a translations table of strings and translations.
 	// Plurals are stored separately with the first message as key.
 	var mLen, mIdx, tLen, tIdx uint32
+	var dec *encoding.Decoder
+	var nplurals int
 	for i := 0; i < count; i++ {
 		// Get message length and position.
 		r.Seek(mTableIdx, 0)
@@ -106,8 +118,35 @@ func (mr *MoReader) Read(c *Catalog, r io.ReadSeeker) error {
 		// Is this is the file header?
 		if len(mb) == 0 {
 			readMoHeader(c, string(tb))
+			var err error
+			if dec, err = charsetDecoder(c); err != nil {
+				return err
+			}
+			if dec != nil {
+				// Read it again, now properly decoded.
+				if tb, err = dec.Bytes(tb); err != nil {
+					return err
+				}
+				readMoHeader(c, string(tb))
+			}
+			if header := c.PluralForms(); header != "" {
+				var fn pluralforms.PluralFunc
+				if nplurals, fn, err = pluralforms.ParseForms(header); err != nil {
+					return err
+				}
+				c.PluralFunc = fn
+			}
 			continue
 		}
+		if dec != nil {
+			var err error
+			if mb, err = dec.Bytes(mb); err != nil {
+				return err
+			}
+			if tb, err = dec.Bytes(tb); err != nil {
+				return err
+			}
+		}
 		// Check for context.
 		mStr, tStr := string(mb), string(tb)
 		var ctx string
@@ -128,36 +167,54 @@ func (mr *MoReader) Read(c *Catalog, r io.ReadSeeker) error {
 			})
 		} else {
 			// Plural.
-			c.Add(&PluralMessage{
+			msg := &PluralMessage{
 				Src:    strings.Split(mStr, "\x00"),
 				Dst:    strings.Split(tStr, "\x00"),
 				Ctx:    ctx,
 				HasCtx: hasCtx,
-			})
-		}
-	}
-	if header, ok := c.Header["plural-forms"]; ok {
-		fn, err := mr.getPluralFunc(header)
-		if err != nil {
-			return err
+			}
+			if nplurals > 0 && len(msg.Dst) != nplurals {
+				return fmt.Errorf("Message %q has %d plural forms, "+
+					"expected %d", msg.Src[0], len(msg.Dst), nplurals)
+			}
+			c.Add(msg)
 		}
-		c.PluralFunc = fn
 	}
 	return nil
 }
 
-func (mr *MoReader) getPluralFunc(header string) (pluralforms.PluralFunc, error) {
-	for _, part := range strings.Split(header, ";") {
-		kv := strings.SplitN(part, "=", 2)
-		if len(kv) == 2 && strings.TrimSpace(kv[0]) == "plural" {
-			if fn, err := pluralforms.Parse(kv[1]); err == nil {
-				return fn, nil
-			} else {
-				return nil, err
-			}
-		}
+// ReadBytes loads a catalog from the given MO file contents. It is
+// convenient to load catalogs embedded in the program, e.g.:
+//
+//	//go:embed locale/pt_BR/LC_MESSAGES/messages.mo
+//	var ptBR []byte
+//
+//	err := new(gettext.MoReader).ReadBytes(c, ptBR)
+func (mr *MoReader) ReadBytes(c *Catalog, data []byte) error {
+	return mr.Read(c, bytes.NewReader(data))
+}
+
+// charsetDecoder returns a decoder to convert the catalog strings to UTF-8,
+// based on the charset declared in the Content-Type header. It returns nil
+// if no conversion is needed.
+func charsetDecoder(c *Catalog) (*encoding.Decoder, error) {
+	charset, err := c.charset()
+	if err != nil {
+		return nil, err
+	}
+	// "CHARSET" is the placeholder used in templates generated by xgettext.
+	if charset == "" || charset == "CHARSET" {
+		return nil, nil
+	}
+	enc, err := ianaindex.IANA.Encoding(charset)
+	if err != nil || enc == nil {
+		return nil, fmt.Errorf("Unsupported charset %q in Content-Type header",
+			charset)
 	}
-	return nil, fmt.Errorf("Malformed Plural-Forms header: %q", header)
+	if enc == unicode.UTF8 {
+		return nil, nil
+	}
+	return enc.NewDecoder(), nil
 }
 
 // readMoHeader parses the translations metadata following GNU .mo conventions.
@@ -179,6 +236,39 @@ func readMoHeader(c *Catalog, header string) {
 	}
 }
 
+// writeHeader returns the catalog header formatted following GNU .mo
+// conventions, with entries sorted by key. The keys, stored in lower case,
+// are written with their canonical names, e.g. "Content-Type".
+func writeHeader(c *Catalog) string {
+	keys := make([]string, 0, len(c.Header))
+	for k, _ := range c.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b := new(bytes.Buffer)
+	for _, k := range keys {
+		b.WriteString(canonicalHeaderKey(k) + ": " + c.Header[k] + "\n")
+	}
+	return b.String()
+}
+
+// headerKeys has the canonical names of header keys that are not spelled
+// like MIME headers.
+var headerKeys = map[string]string{
+	"mime-version":      "MIME-Version",
+	"pot-creation-date": "POT-Creation-Date",
+	"po-revision-date":  "PO-Revision-Date",
+}
+
+// canonicalHeaderKey returns the name of a header key as written by the
+// GNU gettext tools.
+func canonicalHeaderKey(k string) string {
+	if name, ok := headerKeys[strings.ToLower(k)]; ok {
+		return name
+	}
+	return textproto.CanonicalMIMEHeaderKey(k)
+}
+
 // ----------------------------------------------------------------------------
 
 // MoWriter compiles catalogs to GNU MO files.
@@ -250,13 +340,9 @@ func newMoMessageWriter(c *Catalog) (idxs []uint32, msgs []byte) {
 }
 
 func (m *moMessageWriter) getHeader(c *Catalog) Message {
-	b := new(bytes.Buffer)
-	for k, v := range c.Header {
-		b.WriteString(k + ": " + v)
-	}
 	return &SimpleMessage{
 		Src: "",
-		Dst: b.String(),
+		Dst: writeHeader(c),
 	}
 }
 
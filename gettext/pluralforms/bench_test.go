@@ -22,6 +22,17 @@ func BenchmarkParser(b *testing.B) {
 	}
 }
 
+func BenchmarkParse(b *testing.B) {
+	// Not one of the precomputed forms, so it is cached after the first call.
+	expr := "n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 3"
+	for i := 0; i < b.N; i++ {
+		_, err := Parse(expr)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkEval(b *testing.B) {
 	expr := "n%10==1&&n%100!=11?0:n%10>=2&&n%10<=4&&(n%100<10||n%100>=20)?1:2"
 	fn, err := createPluralFunc(expr)
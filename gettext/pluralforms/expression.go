@@ -0,0 +1,153 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pluralforms
+
+// ParseTree parses a Plural-Forms expression and returns its parse tree.
+func ParseTree(expr string) (*Expression, error) {
+	n, err := parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Expression{root: n}, nil
+}
+
+// Expression is a parsed Plural-Forms expression.
+type Expression struct {
+	root node
+}
+
+// Eval evaluates the expression for the given amount, returning the plural
+// form index.
+func (e *Expression) Eval(n int) (int, error) {
+	return evalTree(e.root, n)
+}
+
+// EvalContext evaluates the expression using the given variable values,
+// returning the plural form index.
+func (e *Expression) EvalContext(ctx EvalContext) (int, error) {
+	return evalResult(e.root.Eval(ctx))
+}
+
+// String returns the canonical form of the expression, without spaces and
+// using only the parentheses required by operator precedence.
+func (e *Expression) String() string {
+	return formatNode(e.root, 0)
+}
+
+// formatNode returns the string representation of a node, enclosed in
+// parentheses if its precedence is lower than the given one.
+func formatNode(n node, prec int) string {
+	var s string
+	var q int
+	switch t := n.(type) {
+	case *ifNode:
+		s = formatNode(t.cond, 1) + "?" + formatNode(t.n1, 0) + ":" +
+			formatNode(t.n2, 0)
+	case *notNode:
+		q = precedence[tokenNot]
+		s = "!" + formatNode(t.n1, q)
+	default:
+		op, n1, n2, ok := binaryOp(n)
+		if !ok {
+			return n.String()
+		}
+		// Operators are left-associative.
+		q = precedence[op]
+		s = formatNode(n1, q) + op.String() + formatNode(n2, q+1)
+	}
+	if q < prec {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// binaryOp returns the operator and operands for a binary operator node.
+func binaryOp(n node) (op tokenType, n1, n2 node, ok bool) {
+	switch t := n.(type) {
+	case *mulNode:
+		return tokenMul, t.n1, t.n2, true
+	case *divNode:
+		return tokenDiv, t.n1, t.n2, true
+	case *modNode:
+		return tokenMod, t.n1, t.n2, true
+	case *addNode:
+		return tokenAdd, t.n1, t.n2, true
+	case *subNode:
+		return tokenSub, t.n1, t.n2, true
+	case *eqNode:
+		return tokenEq, t.n1, t.n2, true
+	case *notEqNode:
+		return tokenNotEq, t.n1, t.n2, true
+	case *gtNode:
+		return tokenGt, t.n1, t.n2, true
+	case *gteNode:
+		return tokenGte, t.n1, t.n2, true
+	case *ltNode:
+		return tokenLt, t.n1, t.n2, true
+	case *lteNode:
+		return tokenLte, t.n1, t.n2, true
+	case *orNode:
+		return tokenOr, t.n1, t.n2, true
+	case *andNode:
+		return tokenAnd, t.n1, t.n2, true
+	}
+	return 0, nil, nil, false
+}
+
+// fold returns a copy of the tree where sub-expressions that only depend on
+// literals are replaced by their values.
+func fold(n node) node {
+	switch t := n.(type) {
+	case *ifNode:
+		cond, n1, n2 := fold(t.cond), fold(t.n1), fold(t.n2)
+		if v, ok := cond.(boolNode); ok {
+			if v {
+				return n1
+			}
+			return n2
+		}
+		return &ifNode{cond, n1, n2}
+	case *notNode:
+		return foldLiteral(&notNode{n1: fold(t.n1)})
+	default:
+		op, n1, n2, ok := binaryOp(n)
+		if !ok {
+			return n
+		}
+		return foldLiteral(newBinaryOpNode(token{typ: op}, fold(n1), fold(n2)))
+	}
+}
+
+// foldLiteral evaluates an operator node if all its operands are literals.
+// Nodes that fail to evaluate are kept, so that errors are reported when
+// the expression is evaluated.
+func foldLiteral(n node) node {
+	var operands []node
+	switch t := n.(type) {
+	case *notNode:
+		operands = []node{t.n1}
+	default:
+		_, n1, n2, _ := binaryOp(n)
+		operands = []node{n1, n2}
+	}
+	for _, v := range operands {
+		if !isLiteral(v) {
+			return n
+		}
+	}
+	if v := n.Eval(EvalContext{}); isLiteral(v) {
+		return v
+	}
+	return n
+}
+
+// isLiteral returns true if the node is an int or bool literal.
+func isLiteral(n node) bool {
+	switch n.(type) {
+	case intNode, boolNode:
+		return true
+	}
+	return false
+}
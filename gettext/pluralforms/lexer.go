@@ -13,6 +13,7 @@ import (
 const (
 	eof     = -1
 	numbers = "0123456789"
+	letters = "abcdefghijklmnopqrstuvwxyz"
 	symbols = "*/%+-=!<>|&?:"
 )
 
@@ -141,8 +142,6 @@ func (l *lexer) next() token {
 			// ignore spaces.
 		case eof:
 			return token{typ: tokenEOF}
-		case 'n':
-			return token{typ: tokenVar}
 		case '*', '/', '%', '+', '-', '?', ':', '(', ')':
 			return token{typ: stringToToken[string(r)]}
 		default:
@@ -150,6 +149,9 @@ func (l *lexer) next() token {
 			if s := l.nextRun(numbers); s != "" {
 				return token{typ: tokenInt, val: s}
 			}
+			if s := l.nextRun(letters); s != "" {
+				return token{typ: tokenVar, val: s}
+			}
 			if s := l.nextRun(symbols); s != "" {
 				if typ, ok := stringToToken[s]; ok {
 					return token{typ: typ}
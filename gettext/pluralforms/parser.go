@@ -23,8 +23,8 @@ var precedence = map[tokenType]int{
 	tokenGte:   3,
 	tokenLt:    3,
 	tokenLte:   3,
-	tokenOr:    2,
-	tokenAnd:   1,
+	tokenAnd:   2,
+	tokenOr:    1,
 }
 
 // Map of operators that are right-associative. We don't have any. :P
@@ -210,25 +210,46 @@ func newValueNode(t token) node {
 		}
 		return invalidExpression
 	case tokenVar:
-		return varNode(0)
+		return varNode(t.val)
 	}
 	panic("unreachable")
 }
 
 // ----------------------------------------------------------------------------
 
+// EvalContext holds the values of the variables used to evaluate an
+// expression.
+type EvalContext struct {
+	N    int            // value of n, the amount used by gettext
+	Vars map[string]int // values of other variables, e.g., CLDR operands
+}
+
 type node interface {
-	Eval(ctx int) node
+	Eval(ctx EvalContext) node
 	String() string
 }
 
 // ----------------------------------------------------------------------------
 
-var invalidExpression = errorNode("Invalid expression")
+var (
+	invalidExpression = errorNode("Invalid expression")
+	divisionByZero    = errorNode("Division by zero")
+)
+
+// evalError returns the first error among the evaluated nodes, or
+// invalidExpression if none of them is an error.
+func evalError(nodes ...node) node {
+	for _, n := range nodes {
+		if err, ok := n.(errorNode); ok {
+			return err
+		}
+	}
+	return invalidExpression
+}
 
 type errorNode string
 
-func (n errorNode) Eval(ctx int) node {
+func (n errorNode) Eval(ctx EvalContext) node {
 	return n
 }
 
@@ -236,11 +257,15 @@ func (n errorNode) String() string {
 	return string(n)
 }
 
+func (n errorNode) Error() string {
+	return string(n)
+}
+
 // ----------------------------------------------------------------------------
 
 type boolNode bool
 
-func (n boolNode) Eval(ctx int) node {
+func (n boolNode) Eval(ctx EvalContext) node {
 	return n
 }
 
@@ -252,7 +277,7 @@ func (n boolNode) String() string {
 
 type intNode int
 
-func (n intNode) Eval(ctx int) node {
+func (n intNode) Eval(ctx EvalContext) node {
 	return n
 }
 
@@ -262,14 +287,20 @@ func (n intNode) String() string {
 
 // ----------------------------------------------------------------------------
 
-type varNode int
+type varNode string
 
-func (n varNode) Eval(ctx int) node {
-	return intNode(ctx)
+func (n varNode) Eval(ctx EvalContext) node {
+	if n == "n" {
+		return intNode(ctx.N)
+	}
+	if v, ok := ctx.Vars[string(n)]; ok {
+		return intNode(v)
+	}
+	return errorNode(fmt.Sprintf("Undefined variable %s", string(n)))
 }
 
 func (n varNode) String() string {
-	return "n"
+	return string(n)
 }
 
 // ----------------------------------------------------------------------------
@@ -278,11 +309,12 @@ type notNode struct {
 	n1 node
 }
 
-func (n *notNode) Eval(ctx int) node {
-	if x, ok := n.n1.Eval(ctx).(boolNode); ok {
+func (n *notNode) Eval(ctx EvalContext) node {
+	v1 := n.n1.Eval(ctx)
+	if x, ok := v1.(boolNode); ok {
 		return !x
 	}
-	return invalidExpression
+	return evalError(v1)
 }
 
 func (n *notNode) String() string {
@@ -296,13 +328,14 @@ type mulNode struct {
 	n2 node
 }
 
-func (n *mulNode) Eval(ctx int) node {
-	if x, ok := n.n1.Eval(ctx).(intNode); ok {
-		if y, ok := n.n2.Eval(ctx).(intNode); ok {
+func (n *mulNode) Eval(ctx EvalContext) node {
+	v1, v2 := n.n1.Eval(ctx), n.n2.Eval(ctx)
+	if x, ok := v1.(intNode); ok {
+		if y, ok := v2.(intNode); ok {
 			return x * y
 		}
 	}
-	return invalidExpression
+	return evalError(v1, v2)
 }
 
 func (n *mulNode) String() string {
@@ -316,13 +349,17 @@ type divNode struct {
 	n2 node
 }
 
-func (n *divNode) Eval(ctx int) node {
-	if x, ok := n.n1.Eval(ctx).(intNode); ok {
-		if y, ok := n.n2.Eval(ctx).(intNode); ok {
+func (n *divNode) Eval(ctx EvalContext) node {
+	v1, v2 := n.n1.Eval(ctx), n.n2.Eval(ctx)
+	if x, ok := v1.(intNode); ok {
+		if y, ok := v2.(intNode); ok {
+			if y == 0 {
+				return divisionByZero
+			}
 			return x / y
 		}
 	}
-	return invalidExpression
+	return evalError(v1, v2)
 }
 
 func (n *divNode) String() string {
@@ -336,13 +373,17 @@ type modNode struct {
 	n2 node
 }
 
-func (n *modNode) Eval(ctx int) node {
-	if x, ok := n.n1.Eval(ctx).(intNode); ok {
-		if y, ok := n.n2.Eval(ctx).(intNode); ok {
+func (n *modNode) Eval(ctx EvalContext) node {
+	v1, v2 := n.n1.Eval(ctx), n.n2.Eval(ctx)
+	if x, ok := v1.(intNode); ok {
+		if y, ok := v2.(intNode); ok {
+			if y == 0 {
+				return divisionByZero
+			}
 			return x % y
 		}
 	}
-	return invalidExpression
+	return evalError(v1, v2)
 }
 
 func (n *modNode) String() string {
@@ -356,13 +397,14 @@ type addNode struct {
 	n2 node
 }
 
-func (n *addNode) Eval(ctx int) node {
-	if x, ok := n.n1.Eval(ctx).(intNode); ok {
-		if y, ok := n.n2.Eval(ctx).(intNode); ok {
+func (n *addNode) Eval(ctx EvalContext) node {
+	v1, v2 := n.n1.Eval(ctx), n.n2.Eval(ctx)
+	if x, ok := v1.(intNode); ok {
+		if y, ok := v2.(intNode); ok {
 			return x + y
 		}
 	}
-	return invalidExpression
+	return evalError(v1, v2)
 }
 
 func (n *addNode) String() string {
@@ -376,13 +418,14 @@ type subNode struct {
 	n2 node
 }
 
-func (n *subNode) Eval(ctx int) node {
-	if x, ok := n.n1.Eval(ctx).(intNode); ok {
-		if y, ok := n.n2.Eval(ctx).(intNode); ok {
+func (n *subNode) Eval(ctx EvalContext) node {
+	v1, v2 := n.n1.Eval(ctx), n.n2.Eval(ctx)
+	if x, ok := v1.(intNode); ok {
+		if y, ok := v2.(intNode); ok {
 			return x - y
 		}
 	}
-	return invalidExpression
+	return evalError(v1, v2)
 }
 
 func (n *subNode) String() string {
@@ -396,18 +439,19 @@ type eqNode struct {
 	n2 node
 }
 
-func (n *eqNode) Eval(ctx int) node {
-	switch x := n.n1.Eval(ctx).(type) {
+func (n *eqNode) Eval(ctx EvalContext) node {
+	v1, v2 := n.n1.Eval(ctx), n.n2.Eval(ctx)
+	switch x := v1.(type) {
 	case boolNode:
-		if y, ok := n.n2.Eval(ctx).(boolNode); ok {
+		if y, ok := v2.(boolNode); ok {
 			return boolNode(x == y)
 		}
 	case intNode:
-		if y, ok := n.n2.Eval(ctx).(intNode); ok {
+		if y, ok := v2.(intNode); ok {
 			return boolNode(x == y)
 		}
 	}
-	return invalidExpression
+	return evalError(v1, v2)
 }
 
 func (n *eqNode) String() string {
@@ -421,18 +465,19 @@ type notEqNode struct {
 	n2 node
 }
 
-func (n *notEqNode) Eval(ctx int) node {
-	switch x := n.n1.Eval(ctx).(type) {
+func (n *notEqNode) Eval(ctx EvalContext) node {
+	v1, v2 := n.n1.Eval(ctx), n.n2.Eval(ctx)
+	switch x := v1.(type) {
 	case boolNode:
-		if y, ok := n.n2.Eval(ctx).(boolNode); ok {
+		if y, ok := v2.(boolNode); ok {
 			return boolNode(x != y)
 		}
 	case intNode:
-		if y, ok := n.n2.Eval(ctx).(intNode); ok {
+		if y, ok := v2.(intNode); ok {
 			return boolNode(x != y)
 		}
 	}
-	return invalidExpression
+	return evalError(v1, v2)
 }
 
 func (n *notEqNode) String() string {
@@ -446,13 +491,14 @@ type gtNode struct {
 	n2 node
 }
 
-func (n *gtNode) Eval(ctx int) node {
-	if x, ok := n.n1.Eval(ctx).(intNode); ok {
-		if y, ok := n.n2.Eval(ctx).(intNode); ok {
+func (n *gtNode) Eval(ctx EvalContext) node {
+	v1, v2 := n.n1.Eval(ctx), n.n2.Eval(ctx)
+	if x, ok := v1.(intNode); ok {
+		if y, ok := v2.(intNode); ok {
 			return boolNode(x > y)
 		}
 	}
-	return invalidExpression
+	return evalError(v1, v2)
 }
 
 func (n *gtNode) String() string {
@@ -466,13 +512,14 @@ type gteNode struct {
 	n2 node
 }
 
-func (n *gteNode) Eval(ctx int) node {
-	if x, ok := n.n1.Eval(ctx).(intNode); ok {
-		if y, ok := n.n2.Eval(ctx).(intNode); ok {
+func (n *gteNode) Eval(ctx EvalContext) node {
+	v1, v2 := n.n1.Eval(ctx), n.n2.Eval(ctx)
+	if x, ok := v1.(intNode); ok {
+		if y, ok := v2.(intNode); ok {
 			return boolNode(x >= y)
 		}
 	}
-	return invalidExpression
+	return evalError(v1, v2)
 }
 
 func (n *gteNode) String() string {
@@ -486,13 +533,14 @@ type ltNode struct {
 	n2 node
 }
 
-func (n *ltNode) Eval(ctx int) node {
-	if x, ok := n.n1.Eval(ctx).(intNode); ok {
-		if y, ok := n.n2.Eval(ctx).(intNode); ok {
+func (n *ltNode) Eval(ctx EvalContext) node {
+	v1, v2 := n.n1.Eval(ctx), n.n2.Eval(ctx)
+	if x, ok := v1.(intNode); ok {
+		if y, ok := v2.(intNode); ok {
 			return boolNode(x < y)
 		}
 	}
-	return invalidExpression
+	return evalError(v1, v2)
 }
 
 func (n *ltNode) String() string {
@@ -506,13 +554,14 @@ type lteNode struct {
 	n2 node
 }
 
-func (n *lteNode) Eval(ctx int) node {
-	if x, ok := n.n1.Eval(ctx).(intNode); ok {
-		if y, ok := n.n2.Eval(ctx).(intNode); ok {
+func (n *lteNode) Eval(ctx EvalContext) node {
+	v1, v2 := n.n1.Eval(ctx), n.n2.Eval(ctx)
+	if x, ok := v1.(intNode); ok {
+		if y, ok := v2.(intNode); ok {
 			return boolNode(x <= y)
 		}
 	}
-	return invalidExpression
+	return evalError(v1, v2)
 }
 
 func (n *lteNode) String() string {
@@ -526,13 +575,14 @@ type orNode struct {
 	n2 node
 }
 
-func (n *orNode) Eval(ctx int) node {
-	if x, ok := n.n1.Eval(ctx).(boolNode); ok {
-		if y, ok := n.n2.Eval(ctx).(boolNode); ok {
+func (n *orNode) Eval(ctx EvalContext) node {
+	v1, v2 := n.n1.Eval(ctx), n.n2.Eval(ctx)
+	if x, ok := v1.(boolNode); ok {
+		if y, ok := v2.(boolNode); ok {
 			return boolNode(x || y)
 		}
 	}
-	return invalidExpression
+	return evalError(v1, v2)
 }
 
 func (n *orNode) String() string {
@@ -546,13 +596,14 @@ type andNode struct {
 	n2 node
 }
 
-func (n *andNode) Eval(ctx int) node {
-	if x, ok := n.n1.Eval(ctx).(boolNode); ok {
-		if y, ok := n.n2.Eval(ctx).(boolNode); ok {
+func (n *andNode) Eval(ctx EvalContext) node {
+	v1, v2 := n.n1.Eval(ctx), n.n2.Eval(ctx)
+	if x, ok := v1.(boolNode); ok {
+		if y, ok := v2.(boolNode); ok {
 			return boolNode(x && y)
 		}
 	}
-	return invalidExpression
+	return evalError(v1, v2)
 }
 
 func (n *andNode) String() string {
@@ -567,15 +618,16 @@ type ifNode struct {
 	n2   node
 }
 
-func (n *ifNode) Eval(ctx int) node {
-	if x, ok := n.cond.Eval(ctx).(boolNode); ok {
+func (n *ifNode) Eval(ctx EvalContext) node {
+	cond := n.cond.Eval(ctx)
+	if x, ok := cond.(boolNode); ok {
 		if x {
 			return n.n1.Eval(ctx)
 		} else {
 			return n.n2.Eval(ctx)
 		}
 	}
-	return invalidExpression
+	return evalError(cond)
 }
 
 func (n *ifNode) String() string {
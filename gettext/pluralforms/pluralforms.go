@@ -5,7 +5,10 @@
 package pluralforms
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 // PluralFunc is used to select a plural form index for a given amount.
@@ -20,13 +23,69 @@ var DefaultPluralFunc = pluralFunc2
 //
 // If the expression is malformed it returns an error. Even if it doesn't
 // return an error the returned PluralFunc can still fail to evaluate.
-// If this occurs it returns -1 (an invalid index).
+// If this occurs it returns -1 (an invalid index). Use ParseChecked to get
+// the evaluation error instead.
+//
+// Parsed expressions are cached, so parsing the same expression again is
+// cheap.
 func Parse(expr string) (PluralFunc, error) {
 	expr = strings.Replace(expr, " ", "", -1)
 	if f, ok := pluralFuncs[expr]; ok {
 		return f, nil
 	}
-	return createPluralFunc(expr)
+	cacheMutex.RLock()
+	f, ok := cache[expr]
+	cacheMutex.RUnlock()
+	if ok {
+		return f, nil
+	}
+	f, err := createPluralFunc(expr)
+	if err != nil {
+		return nil, err
+	}
+	cacheMutex.Lock()
+	cache[expr] = f
+	cacheMutex.Unlock()
+	return f, nil
+}
+
+// Cache of parsed expressions, keyed by expression without spaces.
+var (
+	cache      = map[string]PluralFunc{}
+	cacheMutex sync.RWMutex
+)
+
+// ParseForms parses a Plural-Forms header value, e.g.:
+//
+//	nplurals=2; plural=n != 1;
+//
+// It returns the number of plural forms and a PluralFunc capable of
+// evaluating the plural expression. Both components are required.
+func ParseForms(expr string) (nplurals int, fn PluralFunc, err error) {
+	var hasPlural bool
+	for _, part := range strings.Split(expr, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(kv[0]) {
+		case "nplurals":
+			nplurals, err = strconv.Atoi(strings.TrimSpace(kv[1]))
+			if err != nil || nplurals < 1 {
+				return 0, nil, fmt.Errorf("Invalid nplurals in Plural-Forms "+
+					"header: %q", expr)
+			}
+		case "plural":
+			if fn, err = Parse(kv[1]); err != nil {
+				return 0, nil, err
+			}
+			hasPlural = true
+		}
+	}
+	if nplurals == 0 || !hasPlural {
+		return 0, nil, fmt.Errorf("Malformed Plural-Forms header: %q", expr)
+	}
+	return nplurals, fn, nil
 }
 
 // createPluralFunc parses a Plural-Forms expression and returns a PluralFunc
@@ -36,20 +95,54 @@ func createPluralFunc(expr string) (PluralFunc, error) {
 	if err != nil {
 		return nil, err
 	}
+	tree = fold(tree)
 	return func(n int) int {
-		switch v := tree.Eval(n).(type) {
-		case intNode:
-			return int(v)
-		case boolNode:
-			if v {
-				return 1
-			}
-			return 0
-		}
-		return -1
+		v, _ := evalTree(tree, n)
+		return v
+	}, nil
+}
+
+// ParseChecked is like Parse, but the returned function reports an error
+// if the expression fails to evaluate instead of returning -1.
+func ParseChecked(expr string) (func(int) (int, error), error) {
+	expr = strings.Replace(expr, " ", "", -1)
+	if f, ok := pluralFuncs[expr]; ok {
+		return func(n int) (int, error) {
+			return f(n), nil
+		}, nil
+	}
+	tree, err := parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	tree = fold(tree)
+	return func(n int) (int, error) {
+		return evalTree(tree, n)
 	}, nil
 }
 
+// evalTree evaluates a parse tree for the given amount, returning the
+// plural form index.
+func evalTree(tree node, n int) (int, error) {
+	return evalResult(tree.Eval(EvalContext{N: n}))
+}
+
+// evalResult converts the result of an evaluation to a plural form index.
+func evalResult(result node) (int, error) {
+	switch v := result.(type) {
+	case intNode:
+		return int(v), nil
+	case boolNode:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case errorNode:
+		return -1, v
+	}
+	return -1, invalidExpression
+}
+
 // Precomputed plural funcs taken from the gettext manual. We avoid parsing
 // expressions that match one of these forms. See:
 //
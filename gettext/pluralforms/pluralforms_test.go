@@ -5,6 +5,8 @@
 package pluralforms
 
 import (
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -47,9 +49,275 @@ func TestParse(t *testing.T) {
 				expected := -1
 				result := fn(i)
 				if result != expected {
-					t.Errorf("Expected %d, got %d for n %d. Expression: %s", expected, result, i)
+					t.Errorf("Expected %d, got %d for n %d. Expression: %s", expected, result, i, expr)
 				}
 			}
 		}
 	}
 }
+
+func TestParseForms(t *testing.T) {
+	nplurals, fn, err := ParseForms("nplurals=3; plural=n%10==1 && n%100!=11 ? 0 : n != 0 ? 1 : 2;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nplurals != 3 {
+		t.Errorf("Expected 3 plural forms, got %d.", nplurals)
+	}
+	for i := 0; i < 200; i++ {
+		if expected, result := pluralFunc4(i), fn(i); result != expected {
+			t.Errorf("Expected %d, got %d for n %d.", expected, result, i)
+		}
+	}
+	// Now some bad headers.
+	badHeaders := []string{
+		"",
+		"plural=n != 1;",
+		"nplurals=2;",
+		"nplurals=x; plural=n != 1;",
+		"nplurals=0; plural=0;",
+		"nplurals=2; plural=n != ;",
+	}
+	for _, header := range badHeaders {
+		if _, _, err := ParseForms(header); err == nil {
+			t.Errorf("Expected error for header %q.", header)
+		}
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	// && binds tighter than ||, as in C.
+	exprs := map[string]PluralFunc{
+		"n==1 && n%10==2 || n==0": func(n int) int {
+			if n == 1 && n%10 == 2 || n == 0 {
+				return 1
+			}
+			return 0
+		},
+		"n==0 || n==1 && n%10==2": func(n int) int {
+			if n == 0 || n == 1 && n%10 == 2 {
+				return 1
+			}
+			return 0
+		},
+		"n==1 ? 0 : n==0 || n%100>0 && n%100<20 ? 1 : 2":                                 pluralFunc6,
+		"n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%100<10 || n%10>=2 && n%100>=20 ? 1 : 2": pluralFunc7,
+		"n%100==1 ? 0 : n%100==2 ? 1 : n%100==3 || n%100==4 ? 2 : 3":                     pluralFunc11,
+	}
+	for expr, fn := range exprs {
+		fn2, err := Parse(expr)
+		if err != nil {
+			t.Errorf("Failed to parse %q (%s).", expr, err)
+			continue
+		}
+		for i := 0; i < 200; i++ {
+			if expected, result := fn(i), fn2(i); result != expected {
+				t.Errorf("Expected %d, got %d for n %d. Expression: %s", expected, result, i, expr)
+			}
+		}
+	}
+}
+
+func TestParseCache(t *testing.T) {
+	exprs := []string{
+		"n%10==1 ? 0 : 1",
+		"n == 2 ? 0 : n%7",
+		"(n>3) ? 1 : 0",
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			expr := exprs[i%len(exprs)]
+			fn, err := Parse(expr)
+			if err != nil {
+				t.Errorf("Failed to parse %q (%s).", expr, err)
+				return
+			}
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+	for _, expr := range exprs {
+		cacheMutex.RLock()
+		_, ok := cache[strings.Replace(expr, " ", "", -1)]
+		cacheMutex.RUnlock()
+		if !ok {
+			t.Errorf("Expected %q to be cached.", expr)
+		}
+	}
+	fn, err := Parse(exprs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := fn(11); n != 0 {
+		t.Errorf("Expected 0, got %d.", n)
+	}
+}
+
+func TestExpressionString(t *testing.T) {
+	exprs := map[string]string{
+		"n != 1":                                 "n!=1",
+		"(n==1) ? 0 : (n>=2 && n<=4) ? 1 : 2":    "n==1?0:n>=2&&n<=4?1:2",
+		"n%10>=2 && (n%100<10 || n%100>=20)":     "n%10>=2&&(n%100<10||n%100>=20)",
+		"(n%10>=2 && n%100<10) || n%100>=20":     "n%10>=2&&n%100<10||n%100>=20",
+		"(n+1)*2":                                "(n+1)*2",
+		"(n-1)-2":                                "n-1-2",
+		"n-(1-2)":                                "n-(1-2)",
+		"!(n==1)":                                "!(n==1)",
+		"(n==1 ? 0 : 1) == 0 ? 2 : 3":            "(n==1?0:1)==0?2:3",
+		"n==1 ? (n==2 ? 0 : 1) : (n==3 ? 2 : 3)": "n==1?n==2?0:1:n==3?2:3",
+	}
+	for expr, expected := range exprs {
+		e, err := ParseTree(expr)
+		if err != nil {
+			t.Errorf("Failed to parse %q (%s).", expr, err)
+			continue
+		}
+		if s := e.String(); s != expected {
+			t.Errorf("Expected %q, got %q.", expected, s)
+		}
+	}
+	// The canonical form evaluates to the same results.
+	for expr, fn := range pluralFuncs {
+		e, err := ParseTree(expr)
+		if err != nil {
+			t.Errorf("Failed to parse %q (%s).", expr, err)
+			continue
+		}
+		fn2, err := createPluralFunc(e.String())
+		if err != nil {
+			t.Errorf("Failed to parse %q (%s).", e.String(), err)
+			continue
+		}
+		for i := 0; i < 200; i++ {
+			if expected, result := fn(i), fn2(i); result != expected {
+				t.Errorf("Expected %d, got %d for n %d. Expression: %s", expected, result, i, e)
+			}
+		}
+	}
+}
+
+func TestParseChecked(t *testing.T) {
+	exprs := map[string]string{
+		"n && 1":           "Invalid expression",
+		"!n":               "Invalid expression",
+		"n == 1 ? n : n>2": "",
+		"n%(n-1) == 0":     "Division by zero",
+		"2 + 10/(n-1)":     "Division by zero",
+		"n != 1":           "",
+	}
+	for expr, msg := range exprs {
+		fn, err := ParseChecked(expr)
+		if err != nil {
+			t.Errorf("Failed to parse %q (%s).", expr, err)
+			continue
+		}
+		_, err = fn(1)
+		if msg == "" {
+			if err != nil {
+				t.Errorf("Unexpected error for %q: %s", expr, err)
+			}
+		} else if err == nil || err.Error() != msg {
+			t.Errorf("Expected error %q for %q, got %v.", msg, expr, err)
+		}
+	}
+	// The unchecked version returns -1 and doesn't panic.
+	fn, err := Parse("n%(n-1) == 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := fn(1); n != -1 {
+		t.Errorf("Expected -1, got %d.", n)
+	}
+	if _, err := ParseChecked("1 ?"); err == nil {
+		t.Errorf("Expected error for malformed expression.")
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	// CLDR rule for "one" in English: i = 1 and v = 0.
+	e, err := ParseTree("i == 1 && v == 0 ? 0 : 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		i, v     int
+		expected int
+	}{
+		{1, 0, 0}, // 1
+		{1, 1, 1}, // 1.0
+		{2, 0, 1}, // 2
+		{0, 1, 1}, // 0.5
+	}
+	for _, test := range tests {
+		ctx := EvalContext{Vars: map[string]int{"i": test.i, "v": test.v}}
+		result, err := e.EvalContext(ctx)
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		} else if result != test.expected {
+			t.Errorf("Expected %d, got %d for i %d, v %d.", test.expected, result, test.i, test.v)
+		}
+	}
+	if _, err := e.Eval(1); err == nil || err.Error() != "Undefined variable i" {
+		t.Errorf("Expected undefined variable error, got %v.", err)
+	}
+
+	// n is used alongside other variables.
+	e, err = ParseTree("n == 1 && v == 0 ? 0 : 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := e.EvalContext(EvalContext{N: 1, Vars: map[string]int{"v": 0}})
+	if err != nil || result != 0 {
+		t.Errorf("Expected 0, got %d (%v).", result, err)
+	}
+	if result, err := e.Eval(1); err == nil {
+		t.Errorf("Expected error, got %d.", result)
+	}
+}
+
+func TestFold(t *testing.T) {
+	folded := map[string]string{
+		"100 % 10":                 "0",
+		"n % (5 * 2) == 1":         "n%10==1",
+		"(2 > 1) ? n : 0":          "n",
+		"!(1 == 2) && n == 1":      "true&&n==1",
+		"n == 1 ? 4 / 2 : 7 - 3":   "n==1?2:4",
+		"n % (1 - 1) == 0 ? 0 : 1": "n%0==0?0:1",
+	}
+	for expr, expected := range folded {
+		tree, err := parse(expr)
+		if err != nil {
+			t.Errorf("Failed to parse %q (%s).", expr, err)
+			continue
+		}
+		if s := formatNode(fold(tree), 0); s != expected {
+			t.Errorf("Expected %q, got %q.", expected, s)
+		}
+	}
+	// Folded and unfolded trees evaluate to the same results.
+	exprs := []string{
+		"n % (5 * 2) == 1 && n % (10 * 10) != 11 ? 0 : (3 > 2) ? 1 : 2",
+		"n % (1 - 1) == 0 ? 0 : 1",
+	}
+	for expr, _ := range pluralFuncs {
+		exprs = append(exprs, expr)
+	}
+	for _, expr := range exprs {
+		tree, err := parse(expr)
+		if err != nil {
+			t.Errorf("Failed to parse %q (%s).", expr, err)
+			continue
+		}
+		ftree := fold(tree)
+		for i := 0; i < 1000; i++ {
+			n1, err1 := evalTree(tree, i)
+			n2, err2 := evalTree(ftree, i)
+			if n1 != n2 || err1 != err2 {
+				t.Errorf("Expected %d (%v), got %d (%v) for n %d. Expression: %s", n1, err1, n2, err2, i, expr)
+			}
+		}
+	}
+}
@@ -0,0 +1,594 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gettext
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"code.google.com/p/sadbox/gettext/pluralforms"
+	"golang.org/x/text/encoding"
+)
+
+// poLineWidth is the maximum width of a line in a PO file, following the
+// default used by GNU tools.
+const poLineWidth = 79
+
+// PoReader loads catalogs from GNU PO files.
+//
+// Messages and translations are converted to UTF-8 using the charset
+// declared in the Content-Type header. If no charset is declared they
+// are assumed to be UTF-8.
+//
+// Obsolete messages, commented with "#~", are stored in Catalog.Obsolete
+// so that they can be written back, but they are not used for
+// translations.
+type PoReader struct {
+	// SkipFuzzy drops messages flagged as "fuzzy", so that they are
+	// treated as untranslated.
+	SkipFuzzy bool
+}
+
+// Read loads a catalog from the given reader.
+func (pr *PoReader) Read(c *Catalog, r io.Reader) error {
+	p := &poParser{c: c, skipFuzzy: pr.SkipFuzzy}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		p.lineNum++
+		if err := p.parseLine(scanner.Text()); err != nil {
+			return fmt.Errorf("Malformed PO file at line %d: %s",
+				p.lineNum, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := p.flush(); err != nil {
+		return fmt.Errorf("Malformed PO file at line %d: %s", p.lineNum, err)
+	}
+	return nil
+}
+
+// poParser holds the state while reading a PO file. Entries are collected
+// line by line and added to the catalog when complete.
+type poParser struct {
+	c         *Catalog
+	skipFuzzy bool
+	dec       *encoding.Decoder
+	lineNum   int
+	// Current entry.
+	comments  commentParser
+	ctx       string
+	hasCtx    bool
+	id        string
+	hasID     bool
+	idPlural  string
+	hasPlural bool
+	str       []string
+	obsolete  bool
+	keyword   string // last keyword, target of continuation lines
+	index     int    // msgstr index, target of continuation lines
+}
+
+// parseLine parses a single line of a PO file.
+func (p *poParser) parseLine(line string) error {
+	if p.dec != nil {
+		var err error
+		if line, err = p.dec.String(line); err != nil {
+			return err
+		}
+	}
+	line = strings.TrimSpace(line)
+	switch {
+	case line == "":
+		return p.flush()
+	case strings.HasPrefix(line, "#~"):
+		line = strings.TrimSpace(line[2:])
+		if line == "" {
+			return nil
+		}
+		if strings.HasPrefix(line, "|") {
+			// Previous strings of an obsolete message.
+			return p.parseComment("#" + line)
+		}
+		// Parse first: the string may complete a previous entry.
+		err := p.parseString(line)
+		p.obsolete = true
+		return err
+	case line[0] == '#':
+		return p.parseComment(line)
+	}
+	return p.parseString(line)
+}
+
+// parseComment parses a comment line. A comment after the translations
+// starts a new entry.
+func (p *poParser) parseComment(line string) error {
+	if p.str != nil {
+		if err := p.flush(); err != nil {
+			return err
+		}
+	}
+	return p.comments.parse(line)
+}
+
+// parseString parses a keyword line, e.g. `msgid "foo"`, or a continuation
+// line with only a string.
+func (p *poParser) parseString(line string) error {
+	keyword := ""
+	if line[0] != '"' {
+		i := strings.IndexAny(line, " \t")
+		if i == -1 {
+			return fmt.Errorf("missing string after %q", line)
+		}
+		keyword, line = line[:i], strings.TrimSpace(line[i:])
+	}
+	s, err := poUnquote(line)
+	if err != nil {
+		return err
+	}
+	switch keyword {
+	case "":
+		return p.appendString(s)
+	case "msgctxt", "msgid":
+		if p.str != nil {
+			// A new entry without a blank line between them.
+			if err := p.flush(); err != nil {
+				return err
+			}
+		}
+		if keyword == "msgctxt" {
+			p.ctx, p.hasCtx = s, true
+		} else {
+			p.id, p.hasID = s, true
+		}
+	case "msgid_plural":
+		p.idPlural, p.hasPlural = s, true
+	case "msgstr":
+		p.str = []string{s}
+		p.index = 0
+	default:
+		if !strings.HasPrefix(keyword, "msgstr[") ||
+			!strings.HasSuffix(keyword, "]") {
+			return fmt.Errorf("unknown keyword %q", keyword)
+		}
+		idx, err := strconv.Atoi(keyword[7 : len(keyword)-1])
+		if err != nil || idx < 0 {
+			return fmt.Errorf("invalid plural index in %q", keyword)
+		}
+		for len(p.str) <= idx {
+			p.str = append(p.str, "")
+		}
+		p.str[idx] = s
+		p.index = idx
+		keyword = "msgstr"
+	}
+	p.keyword = keyword
+	return nil
+}
+
+// appendString appends a continuation string to the last keyword.
+func (p *poParser) appendString(s string) error {
+	switch p.keyword {
+	case "msgctxt":
+		p.ctx += s
+	case "msgid":
+		p.id += s
+	case "msgid_plural":
+		p.idPlural += s
+	case "msgstr":
+		p.str[p.index] += s
+	default:
+		return errors.New("string without a keyword")
+	}
+	return nil
+}
+
+// flush adds the current entry to the catalog and resets the parser for
+// the next entry.
+func (p *poParser) flush() error {
+	defer p.reset()
+	if !p.hasID {
+		// Only comments, or nothing at all.
+		return nil
+	}
+	var dst string
+	if len(p.str) > 0 {
+		dst = p.str[0]
+	}
+	if p.id == "" && !p.hasCtx && !p.obsolete {
+		return p.readHeader(dst)
+	}
+	var msg Message
+	if p.hasPlural {
+		msg = &PluralMessage{
+			Src:    []string{p.id, p.idPlural},
+			Dst:    p.str,
+			Ctx:    p.ctx,
+			HasCtx: p.hasCtx,
+			info:   p.comments.info,
+		}
+	} else {
+		msg = &SimpleMessage{
+			Src:    p.id,
+			Dst:    dst,
+			Ctx:    p.ctx,
+			HasCtx: p.hasCtx,
+			info:   p.comments.info,
+		}
+	}
+	if p.obsolete {
+		p.c.Obsolete = append(p.c.Obsolete, msg)
+	} else if !p.skipFuzzy || !isFuzzy(msg) {
+		p.c.Add(msg)
+	}
+	return nil
+}
+
+// readHeader reads the header entry, setting up the charset conversion
+// and the plural function.
+func (p *poParser) readHeader(header string) error {
+	readMoHeader(p.c, header)
+	dec, err := charsetDecoder(p.c)
+	if err != nil {
+		return err
+	}
+	if dec != nil {
+		// Read it again, now properly decoded.
+		if header, err = dec.String(header); err != nil {
+			return err
+		}
+		readMoHeader(p.c, header)
+		p.dec = dec
+	}
+	if header := p.c.PluralForms(); header != "" {
+		_, fn, err := pluralforms.ParseForms(header)
+		if err != nil {
+			return err
+		}
+		p.c.PluralFunc = fn
+	}
+	return nil
+}
+
+// reset clears the current entry.
+func (p *poParser) reset() {
+	*p = poParser{
+		c:         p.c,
+		skipFuzzy: p.skipFuzzy,
+		dec:       p.dec,
+		lineNum:   p.lineNum,
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+// ParseComments returns the meta-data described by the given PO comment
+// lines, classified by prefix:
+//
+//	#  translator comments
+//	#. extracted comments
+//	#: references
+//	#, flags
+//	#| previous context and source, which can span several lines
+//
+// Lines that are not comments, obsolete entries ("#~") and malformed "#|"
+// lines are ignored.
+func ParseComments(lines []string) *MessageInfo {
+	p := commentParser{info: &MessageInfo{}}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "#") || strings.HasPrefix(line, "#~") {
+			continue
+		}
+		p.parse(line)
+	}
+	return p.info
+}
+
+// commentParser fills a MessageInfo from PO comment lines.
+type commentParser struct {
+	info    *MessageInfo
+	keyword string // last "#|" keyword, target of continuation lines
+}
+
+// parse parses a single comment line.
+func (p *commentParser) parse(line string) error {
+	if p.info == nil {
+		p.info = &MessageInfo{}
+	}
+	info := p.info
+	if len(line) < 2 {
+		info.UserComments = append(info.UserComments, "")
+		return nil
+	}
+	switch line[:2] {
+	case "#.":
+		info.SourceComments = append(info.SourceComments,
+			strings.TrimSpace(line[2:]))
+	case "#:":
+		info.References = append(info.References,
+			strings.Fields(line[2:])...)
+	case "#,":
+		for _, flag := range strings.Split(line[2:], ",") {
+			if flag = strings.TrimSpace(flag); flag != "" {
+				info.Flags = append(info.Flags, flag)
+			}
+		}
+	case "#|":
+		return p.parsePrevious(strings.TrimSpace(line[2:]))
+	default:
+		info.UserComments = append(info.UserComments,
+			strings.TrimPrefix(line[1:], " "))
+	}
+	return nil
+}
+
+// parsePrevious parses the content of a "#|" comment, which holds the
+// previous context or source of a message, or a continuation string.
+func (p *commentParser) parsePrevious(line string) error {
+	keyword := ""
+	if !strings.HasPrefix(line, "\"") {
+		i := strings.IndexAny(line, " \t")
+		if i == -1 {
+			return fmt.Errorf("missing string after %q", line)
+		}
+		keyword, line = line[:i], strings.TrimSpace(line[i:])
+	}
+	s, err := poUnquote(line)
+	if err != nil {
+		return err
+	}
+	if keyword == "" {
+		keyword = p.keyword
+	} else if keyword != p.keyword {
+		// Start of a new string, not a continuation.
+		p.setPrevious(keyword, "")
+	}
+	p.keyword = keyword
+	switch keyword {
+	case "msgctxt":
+		p.info.PrevCtx += s
+		p.info.HasPrevCtx = true
+	case "msgid":
+		p.info.PrevSingular += s
+	case "msgid_plural":
+		p.info.PrevPlural += s
+	case "":
+		return errors.New("string without a keyword")
+	default:
+		return fmt.Errorf("unknown keyword %q", keyword)
+	}
+	return nil
+}
+
+// setPrevious sets a previous string for the given keyword.
+func (p *commentParser) setPrevious(keyword, s string) {
+	switch keyword {
+	case "msgctxt":
+		p.info.PrevCtx = s
+	case "msgid":
+		p.info.PrevSingular = s
+	case "msgid_plural":
+		p.info.PrevPlural = s
+	}
+}
+
+// poUnquote unquotes a string from a PO file.
+func poUnquote(s string) (string, error) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", fmt.Errorf("invalid string %s", s)
+	}
+	s = s[1 : len(s)-1]
+	if strings.IndexByte(s, '\\') == -1 {
+		return s, nil
+	}
+	b := new(bytes.Buffer)
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return "", fmt.Errorf("invalid escape at end of string %q", s)
+		}
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'v':
+			b.WriteByte('\v')
+		default:
+			// Backslashes, quotes and anything else are kept as is.
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// ----------------------------------------------------------------------------
+
+// PoWriter writes catalogs to GNU PO files.
+type PoWriter struct {
+}
+
+// Write writes a catalog to the given writer. Obsolete messages are written
+// last, commented with "#~".
+func (pw *PoWriter) Write(c *Catalog, w io.Writer) error {
+	b := new(bytes.Buffer)
+	writePoHeader(b, c)
+	for _, msg := range sortedMessages(c) {
+		b.WriteByte('\n')
+		writePoMessage(b, msg)
+	}
+	for _, msg := range c.Obsolete {
+		b.WriteByte('\n')
+		writePoObsolete(b, msg)
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// writePoHeader writes the catalog header as an entry with an empty msgid.
+func writePoHeader(b *bytes.Buffer, c *Catalog) {
+	writePoString(b, "msgid", "")
+	writePoString(b, "msgstr", writeHeader(c))
+}
+
+// writePoMessage writes a single message, including its meta-data.
+func writePoMessage(b *bytes.Buffer, msg Message) {
+	writePoComments(b, msg.Info())
+	writePoStrings(b, msg)
+}
+
+// writePoObsolete writes an obsolete message. Its meta-data is written as
+// usual, but the message strings are commented with "#~".
+func writePoObsolete(b *bytes.Buffer, msg Message) {
+	writePoComments(b, msg.Info())
+	s := new(bytes.Buffer)
+	writePoStrings(s, msg)
+	for _, line := range strings.SplitAfter(s.String(), "\n") {
+		if line != "" {
+			b.WriteString("#~ " + line)
+		}
+	}
+}
+
+// writePoStrings writes the message context, source and translations.
+func writePoStrings(b *bytes.Buffer, msg Message) {
+	if ctx, err := msg.Context(); err == nil {
+		writePoString(b, "msgctxt", ctx)
+	}
+	switch t := msg.(type) {
+	case *SimpleMessage:
+		writePoString(b, "msgid", t.Src)
+		writePoString(b, "msgstr", t.Dst)
+	case *PluralMessage:
+		var singular, plural string
+		if len(t.Src) > 0 {
+			singular = t.Src[0]
+		}
+		if len(t.Src) > 1 {
+			plural = t.Src[1]
+		}
+		writePoString(b, "msgid", singular)
+		writePoString(b, "msgid_plural", plural)
+		if len(t.Dst) == 0 {
+			writePoString(b, "msgstr[0]", "")
+		}
+		for i, dst := range t.Dst {
+			writePoString(b, fmt.Sprintf("msgstr[%d]", i), dst)
+		}
+	}
+}
+
+// writePoComments writes the message meta-data using the GNU PO comment
+// prefixes, in the order used by GNU tools.
+func writePoComments(b *bytes.Buffer, info *MessageInfo) {
+	for _, v := range info.UserComments {
+		if v == "" {
+			b.WriteString("#\n")
+		} else {
+			b.WriteString("# " + v + "\n")
+		}
+	}
+	for _, v := range info.SourceComments {
+		b.WriteString("#. " + v + "\n")
+	}
+	for _, v := range info.References {
+		b.WriteString("#: " + v + "\n")
+	}
+	if len(info.Flags) > 0 {
+		b.WriteString("#, " + strings.Join(info.Flags, ", ") + "\n")
+	}
+	if info.HasPrevCtx {
+		writePoString(b, "#| msgctxt", info.PrevCtx)
+	}
+	if info.PrevSingular != "" {
+		writePoString(b, "#| msgid", info.PrevSingular)
+	}
+	if info.PrevPlural != "" {
+		writePoString(b, "#| msgid_plural", info.PrevPlural)
+	}
+}
+
+// writePoString writes a keyword followed by a quoted string. Strings that
+// contain newlines or don't fit in a line are wrapped across continuation
+// lines, the way GNU tools do.
+func writePoString(b *bytes.Buffer, keyword, s string) {
+	// Continuation lines for comments keep the comment prefix.
+	var prefix string
+	if strings.HasPrefix(keyword, "#| ") {
+		prefix = "#| "
+	}
+	lines := wrapPoString(s, poLineWidth-len(prefix)-2)
+	if len(lines) == 1 && len(keyword)+len(lines[0])+3 <= poLineWidth {
+		b.WriteString(keyword + " \"" + lines[0] + "\"\n")
+		return
+	}
+	b.WriteString(keyword + " \"\"\n")
+	for _, line := range lines {
+		b.WriteString(prefix + "\"" + line + "\"\n")
+	}
+}
+
+// wrapPoString escapes a string and splits it after each newline and at
+// spaces so that each line has at most width characters, when possible.
+func wrapPoString(s string, width int) []string {
+	var lines []string
+	for _, part := range strings.SplitAfter(s, "\n") {
+		if part == "" {
+			continue
+		}
+		part = poEscape(part)
+		for len(part) > width {
+			i := strings.LastIndex(part[:width], " ")
+			if i == -1 {
+				// Words are never split; break at the next space instead.
+				if i = strings.Index(part[width:], " "); i == -1 {
+					break
+				}
+				i += width
+			}
+			lines = append(lines, part[:i+1])
+			part = part[i+1:]
+		}
+		if part != "" {
+			lines = append(lines, part)
+		}
+	}
+	if lines == nil {
+		lines = []string{""}
+	}
+	return lines
+}
+
+var poEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+)
+
+// poEscape escapes a string to be quoted in a PO file.
+func poEscape(s string) string {
+	return poEscaper.Replace(s)
+}
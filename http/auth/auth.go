@@ -3,19 +3,34 @@
 // license that can be found in the LICENSE file.
 
 /*
-Package sadbox/http/auth parses "Authorization" request headers.
+Package sadbox/http/auth parses "Authorization" and "Proxy-Authorization"
+request headers.
 
 The framework is defined by RFC2617, "HTTP Authentication: Basic and Digest
 Access Authentication":
 
 	http://tools.ietf.org/html/rfc2617
+
+Digest responses using SHA-256 follow RFC7616, "HTTP Digest Access
+Authentication":
+
+	http://tools.ietf.org/html/rfc7616
 */
 package auth
 
 import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"hash"
+	"io"
 	"net/http"
+	"sort"
 	"strings"
 
 	"code.google.com/p/sadbox/http/parser"
@@ -24,9 +39,23 @@ import (
 // ParseRequest extracts an "Authorization" header from a request and returns
 // its scheme and credentials.
 func ParseRequest(r *http.Request) (scheme, credentials string, err error) {
-	h, ok := r.Header["Authorization"]
+	return parseHeader(r, "Authorization")
+}
+
+// ParseProxyRequest extracts a "Proxy-Authorization" header from a request
+// and returns its scheme and credentials. Proxies use it instead of
+// "Authorization" to authenticate clients.
+func ParseProxyRequest(r *http.Request) (scheme, credentials string, err error) {
+	return parseHeader(r, "Proxy-Authorization")
+}
+
+// parseHeader extracts the named header from a request and returns its
+// scheme and credentials.
+func parseHeader(r *http.Request, name string) (scheme, credentials string, err error) {
+	h, ok := r.Header[name]
 	if !ok || len(h) == 0 {
-		return "", "", errors.New("The authorization header is not set.")
+		return "", "", fmt.Errorf("The %s header is not set.",
+			strings.ToLower(name))
 	}
 	return Parse(h[0])
 }
@@ -46,9 +75,20 @@ func Parse(value string) (scheme, credentials string, err error) {
 // NewBasicFromRequest extracts an "Authorization" header from a request and
 // returns the parsed credentials from a "basic" http authentication scheme.
 func NewBasicFromRequest(r *http.Request) (*Basic, error) {
-	scheme, credentials, err := ParseRequest(r)
+	return newBasic(ParseRequest(r))
+}
+
+// NewBasicFromProxyRequest is like NewBasicFromRequest but reads the
+// "Proxy-Authorization" header.
+func NewBasicFromProxyRequest(r *http.Request) (*Basic, error) {
+	return newBasic(ParseProxyRequest(r))
+}
+
+// newBasic returns the parsed credentials from a "basic" http authentication
+// scheme, given the result of parsing a header.
+func newBasic(scheme, credentials string, err error) (*Basic, error) {
 	if err == nil {
-		if scheme == "Basic" {
+		if strings.EqualFold(scheme, "Basic") {
 			return NewBasic(credentials)
 		} else {
 			err = errors.New("The basic authentication header is invalid.")
@@ -60,7 +100,8 @@ func NewBasicFromRequest(r *http.Request) (*Basic, error) {
 // NewBasic parses credentials from a "basic" http authentication scheme.
 func NewBasic(credentials string) (*Basic, error) {
 	if b, err := base64.StdEncoding.DecodeString(credentials); err == nil {
-		parts := strings.Split(string(b), ":")
+		// The password can contain colons; the first one is the separator.
+		parts := strings.SplitN(string(b), ":", 2)
 		if len(parts) == 2 {
 			return &Basic{
 				Username: parts[0],
@@ -80,14 +121,64 @@ type Basic struct {
 	Password string
 }
 
+// Encode returns the credentials encoded as an "Authorization" header value
+// for the "basic" http authentication scheme.
+func (b *Basic) Encode() string {
+	return "Basic " + base64.StdEncoding.EncodeToString(
+		[]byte(b.Username+":"+b.Password))
+}
+
+// SetAuthorization sets the "Authorization" header of the given request
+// using the credentials.
+func (b *Basic) SetAuthorization(r *http.Request) {
+	r.Header.Set("Authorization", b.Encode())
+}
+
+// EqualUsername reports whether the username equals the expected one. The
+// comparison is done in constant time; see EqualPassword.
+func (b *Basic) EqualUsername(expected string) bool {
+	return constantTimeEqual(b.Username, expected)
+}
+
+// EqualPassword reports whether the password equals the expected one.
+//
+// Comparing secrets with == returns as soon as a byte differs, so the
+// response time tells an attacker how much of a guess was right. This
+// comparison takes the same time whatever the inputs, and doesn't reveal
+// the length of the expected password either.
+func (b *Basic) EqualPassword(expected string) bool {
+	return constantTimeEqual(b.Password, expected)
+}
+
+// constantTimeEqual reports whether a and b are equal, in a time that
+// depends on neither their contents nor their lengths. The strings are
+// hashed first because subtle.ConstantTimeCompare returns early when the
+// lengths differ.
+func constantTimeEqual(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
+
 // ----------------------------------------------------------------------------
 
 // NewDigestFromRequest extracts an "Authorization" header from a request and
 // returns the parsed credentials from a "digest" http authentication scheme.
 func NewDigestFromRequest(r *http.Request) (*Digest, error) {
-	scheme, credentials, err := ParseRequest(r)
+	return newDigest(ParseRequest(r))
+}
+
+// NewDigestFromProxyRequest is like NewDigestFromRequest but reads the
+// "Proxy-Authorization" header.
+func NewDigestFromProxyRequest(r *http.Request) (*Digest, error) {
+	return newDigest(ParseProxyRequest(r))
+}
+
+// newDigest returns the parsed credentials from a "digest" http
+// authentication scheme, given the result of parsing a header.
+func newDigest(scheme, credentials string, err error) (*Digest, error) {
 	if err == nil {
-		if scheme == "Digest" {
+		if strings.EqualFold(scheme, "Digest") {
 			return NewDigest(credentials)
 		} else {
 			err = errors.New("The digest authentication header is invalid.")
@@ -97,17 +188,221 @@ func NewDigestFromRequest(r *http.Request) (*Digest, error) {
 }
 
 // NewDigest parses credentials from a "digest" http authentication scheme.
+//
+// It returns an error if a required parameter is missing: username, realm,
+// nonce, uri and response are always required, nc and cnonce are required
+// when qop is set, and cnonce is also required by the "-sess" algorithms.
 func NewDigest(credentials string) (*Digest, error) {
-	// TODO: validate required keys.
-	return &Digest{Values: parser.ParsePairs(credentials)}, nil
+	values := make(map[string]string)
+	for k, v := range parser.ParsePairs(credentials) {
+		values[strings.ToLower(k)] = v
+	}
+	required := []string{"username", "realm", "nonce", "uri", "response"}
+	if values["qop"] != "" {
+		required = append(required, "nc", "cnonce")
+	} else if strings.HasSuffix(strings.ToLower(values["algorithm"]), "-sess") {
+		required = append(required, "cnonce")
+	}
+	for _, k := range required {
+		if values[k] == "" {
+			return nil, fmt.Errorf(
+				"The digest authentication header is missing the %q parameter.", k)
+		}
+	}
+	return &Digest{
+		Username:  values["username"],
+		Realm:     values["realm"],
+		Nonce:     values["nonce"],
+		URI:       values["uri"],
+		Response:  values["response"],
+		Algorithm: values["algorithm"],
+		Opaque:    values["opaque"],
+		Qop:       values["qop"],
+		Nc:        values["nc"],
+		Cnonce:    values["cnonce"],
+	}, nil
 }
 
-// Basic stores credentials for the "digest" http authentication scheme.
+// Digest stores credentials for the "digest" http authentication scheme.
 // Reference:
 //
-//    http://tools.ietf.org/html/rfc2617#section-2
-//
-// This is just a placeholder.
+//    http://tools.ietf.org/html/rfc2617#section-3.2.2
 type Digest struct {
-	Values map[string]string
+	// Required parameters.
+	Username string
+	Realm    string
+	Nonce    string
+	URI      string
+	Response string
+	// Optional parameters.
+	Algorithm string
+	Opaque    string
+	Qop       string
+	Nc        string // required if Qop is set
+	Cnonce    string // required if Qop is set or Algorithm ends in "-sess"
+}
+
+// ComputeResponse computes the expected digest response for the given request
+// method and password, as described in RFC 2617 and RFC 7616.
+// The result can be compared to the Response field to verify the credentials;
+// Verify does this comparison in constant time.
+//
+// The supported algorithms are "MD5" (the default), "MD5-sess", "SHA-256"
+// and "SHA-256-sess", and the supported qop values are "auth" or none.
+// Other values result in an error.
+// Use ComputeResponseWithBody to support "auth-int".
+func (d *Digest) ComputeResponse(method, password string) (string, error) {
+	return d.ComputeResponseWithBody(method, password, nil)
+}
+
+// ComputeResponseWithBody is like ComputeResponse but also supports the qop
+// value "auth-int", which protects the request entity body: the body is read
+// from r and its hash is included in the response. If qop is "auth-int" and
+// r is nil it returns an error; pass an empty reader for an empty body.
+// For other qop values r is not read.
+func (d *Digest) ComputeResponseWithBody(method, password string, r io.Reader) (string, error) {
+	algorithm := strings.ToLower(d.Algorithm)
+	if algorithm == "" {
+		algorithm = "md5"
+	}
+	sess := strings.HasSuffix(algorithm, "-sess")
+	newHash, ok := digestHashes[strings.TrimSuffix(algorithm, "-sess")]
+	if !ok {
+		return "", fmt.Errorf("The digest algorithm %q is not supported.",
+			d.Algorithm)
+	}
+	h := func(s string) string {
+		return hashHex(newHash, s)
+	}
+	ha1 := h(d.Username + ":" + d.Realm + ":" + password)
+	if sess {
+		if d.Cnonce == "" {
+			return "", fmt.Errorf("The digest algorithm %q requires a cnonce.",
+				d.Algorithm)
+		}
+		ha1 = h(ha1 + ":" + d.Nonce + ":" + d.Cnonce)
+	}
+	var ha2 string
+	switch d.Qop {
+	case "", "auth":
+		ha2 = h(method + ":" + d.URI)
+	case "auth-int":
+		if r == nil {
+			return "", errors.New(
+				`The digest qop "auth-int" requires the request body.`)
+		}
+		body := newHash()
+		if _, err := io.Copy(body, r); err != nil {
+			return "", err
+		}
+		ha2 = h(method + ":" + d.URI + ":" + hex.EncodeToString(body.Sum(nil)))
+	default:
+		return "", fmt.Errorf("The digest qop %q is not supported.", d.Qop)
+	}
+	if d.Qop == "" {
+		return h(ha1 + ":" + d.Nonce + ":" + ha2), nil
+	}
+	return h(ha1 + ":" + d.Nonce + ":" + d.Nc + ":" + d.Cnonce +
+		":" + d.Qop + ":" + ha2), nil
+}
+
+// Verify reports whether the digest response matches the one computed for
+// the given request method and password. The comparison is done in constant
+// time.
+func (d *Digest) Verify(method, password string) (bool, error) {
+	return d.VerifyWithBody(method, password, nil)
+}
+
+// VerifyWithBody is like Verify but also supports the qop value "auth-int",
+// reading the request body from r as ComputeResponseWithBody does.
+func (d *Digest) VerifyWithBody(method, password string, r io.Reader) (bool, error) {
+	response, err := d.ComputeResponseWithBody(method, password, r)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare([]byte(response),
+		[]byte(d.Response)) == 1, nil
+}
+
+// digestHashes maps the lowercase digest algorithms, without the "-sess"
+// suffix, to their hash functions.
+var digestHashes = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha-256": sha256.New,
+}
+
+// hashHex returns the hexadecimal checksum of the given string.
+func hashHex(newHash func() hash.Hash, s string) string {
+	h := newHash()
+	io.WriteString(h, s)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ----------------------------------------------------------------------------
+
+// NewBasicChallenge returns a challenge for the "basic" http authentication
+// scheme.
+func NewBasicChallenge(realm string) *Challenge {
+	return &Challenge{Scheme: "Basic", Realm: realm}
+}
+
+// NewDigestChallenge returns a challenge for the "digest" http authentication
+// scheme, with qop set to "auth".
+func NewDigestChallenge(realm, nonce string) *Challenge {
+	return &Challenge{
+		Scheme: "Digest",
+		Realm:  realm,
+		Params: map[string]string{"nonce": nonce, "qop": "auth"},
+	}
+}
+
+// Challenge stores an authentication challenge, sent by servers in a
+// "WWW-Authenticate" header. Reference:
+//
+//    http://tools.ietf.org/html/rfc7235#section-4.1
+type Challenge struct {
+	Scheme string
+	Realm  string
+	Params map[string]string // other parameters, e.g. nonce for digest
+}
+
+// String returns the challenge formatted as a "WWW-Authenticate" header
+// value. The realm comes first, followed by the other parameters sorted by
+// name; a "realm" in Params is ignored. Values are written as quoted
+// strings, except algorithm and stale, which RFC 7616 defines as tokens.
+func (c *Challenge) String() string {
+	b := new(bytes.Buffer)
+	b.WriteString(c.Scheme)
+	b.WriteString(" realm=")
+	b.WriteString(quote(c.Realm))
+	keys := make([]string, 0, len(c.Params))
+	for k, _ := range c.Params {
+		if !strings.EqualFold(k, "realm") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(", " + k + "=")
+		if tokenParams[strings.ToLower(k)] {
+			b.WriteString(c.Params[k])
+		} else {
+			b.WriteString(quote(c.Params[k]))
+		}
+	}
+	return b.String()
+}
+
+// tokenParams has the challenge parameters written without quotes.
+var tokenParams = map[string]bool{
+	"algorithm": true,
+	"stale":     true,
+}
+
+var quoter = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// quote returns a quoted string as defined by RFC 7230, escaping quotes and
+// backslashes.
+func quote(s string) string {
+	return `"` + quoter.Replace(s) + `"`
 }
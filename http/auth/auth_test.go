@@ -7,21 +7,27 @@ package auth
 import (
 	"encoding/base64"
 	"net/http"
+	"strings"
 	"testing"
 )
 
 func TestBasic(t *testing.T) {
 	v1 := base64.StdEncoding.EncodeToString([]byte("foo:bar"))
 	v2 := base64.StdEncoding.EncodeToString([]byte("foo:bar:baz"))
+	// The scheme is case-insensitive.
 	valid := []string{
 		"Basic " + v1,
+		"basic " + v1,
+		"BASIC " + v1,
 	}
 	invalidScheme := []string{
-		"basic " + v1,
 		"Digest " + v1,
+		"Basics " + v1,
 	}
+	v3 := base64.StdEncoding.EncodeToString([]byte("foobar"))
 	invalidCredential := []string{
-		"Basic " + v2,
+		"Basic " + v3,
+		"Basic !" + v1,
 	}
 	for _, v := range valid {
 		r, _ := http.NewRequest("GET", "http://localhost", nil)
@@ -47,6 +53,19 @@ func TestBasic(t *testing.T) {
 			t.Errorf("NewBasic should fail for %q", v)
 		}
 	}
+	// Only the first colon separates username and password.
+	for value, password := range map[string]string{
+		v2: "bar:baz",
+		base64.StdEncoding.EncodeToString([]byte("foo::")):     ":",
+		base64.StdEncoding.EncodeToString([]byte("foo:a:b:c")): "a:b:c",
+	} {
+		b, err := NewBasic(value)
+		if err != nil {
+			t.Errorf("NewBasic should not fail for %q (error: %q)", value, err)
+		} else if b.Username != "foo" || b.Password != password {
+			t.Errorf(`Expected "foo:%s", got "%s:%s"`, password, b.Username, b.Password)
+		}
+	}
 	for _, v := range invalidCredential {
 		_, err := NewBasic(v[6:])
 		if err == nil {
@@ -54,3 +73,379 @@ func TestBasic(t *testing.T) {
 		}
 	}
 }
+
+func TestBasicEqual(t *testing.T) {
+	b := &Basic{"Aladdin", "open sesame"}
+	tests := []struct {
+		expected string
+		username bool
+		password bool
+	}{
+		{"Aladdin", true, false},
+		{"open sesame", false, true},
+		{"aladdin", false, false},
+		{"open sesame!", false, false},
+		{"open", false, false},
+		{"", false, false},
+	}
+	for _, test := range tests {
+		if ok := b.EqualUsername(test.expected); ok != test.username {
+			t.Errorf("EqualUsername(%q): expected %v, got %v", test.expected, test.username, ok)
+		}
+		if ok := b.EqualPassword(test.expected); ok != test.password {
+			t.Errorf("EqualPassword(%q): expected %v, got %v", test.expected, test.password, ok)
+		}
+	}
+	empty := &Basic{}
+	if !empty.EqualUsername("") || !empty.EqualPassword("") {
+		t.Errorf("Empty credentials should equal empty strings")
+	}
+}
+
+const digestCredentials = `username="Mufasa", realm="testrealm@host.com", ` +
+	`nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", uri="/dir/index.html", ` +
+	`qop=auth, nc=00000001, cnonce="0a4f113b", ` +
+	`response="6629fae49393a05397450978507c4ef1", ` +
+	`opaque="5ccc069c403ebaf9f0171e9517f40e41"`
+
+func TestDigest(t *testing.T) {
+	r, _ := http.NewRequest("GET", "http://localhost", nil)
+	r.Header.Set("Authorization", "Digest "+digestCredentials)
+	d, err := NewDigestFromRequest(r)
+	if err != nil {
+		t.Fatalf("NewDigestFromRequest should not fail (error: %q)", err)
+	}
+	expected := Digest{
+		Username: "Mufasa",
+		Realm:    "testrealm@host.com",
+		Nonce:    "dcd98b7102dd2f0e8b11d0f600bfb0c093",
+		URI:      "/dir/index.html",
+		Response: "6629fae49393a05397450978507c4ef1",
+		Opaque:   "5ccc069c403ebaf9f0171e9517f40e41",
+		Qop:      "auth",
+		Nc:       "00000001",
+		Cnonce:   "0a4f113b",
+	}
+	if *d != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *d)
+	}
+	// The scheme is case-insensitive.
+	for _, scheme := range []string{"digest", "DIGEST"} {
+		r.Header.Set("Authorization", scheme+" "+digestCredentials)
+		if _, err = NewDigestFromRequest(r); err != nil {
+			t.Errorf("NewDigestFromRequest should not fail for %q (error: %q)", scheme, err)
+		}
+	}
+	r.Header.Set("Authorization", "Basic "+digestCredentials)
+	if _, err = NewDigestFromRequest(r); err == nil {
+		t.Errorf("NewDigestFromRequest should fail for %q", "Basic")
+	}
+	// Without qop, nc and cnonce are not required.
+	_, err = NewDigest(`username="Mufasa", realm="testrealm@host.com", ` +
+		`nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", uri="/dir/index.html", ` +
+		`response="670fd8c2df070c60b045671b8b24ff02"`)
+	if err != nil {
+		t.Errorf("NewDigest should not fail without qop (error: %q)", err)
+	}
+}
+
+func TestProxyAuthorization(t *testing.T) {
+	v := base64.StdEncoding.EncodeToString([]byte("foo:bar"))
+	r, _ := http.NewRequest("GET", "http://localhost", nil)
+	r.Header.Set("Proxy-Authorization", "Basic "+v)
+	scheme, credentials, err := ParseProxyRequest(r)
+	if err != nil {
+		t.Errorf("ParseProxyRequest should not fail (error: %q)", err)
+	} else if scheme != "Basic" || credentials != v {
+		t.Errorf("Expected %q, got %q", "Basic "+v, scheme+" "+credentials)
+	}
+	b, err := NewBasicFromProxyRequest(r)
+	if err != nil {
+		t.Errorf("NewBasicFromProxyRequest should not fail (error: %q)", err)
+	} else if b.Username != "foo" || b.Password != "bar" {
+		t.Errorf(`Expected "foo:bar", got "%s:%s"`, b.Username, b.Password)
+	}
+	if _, err = NewDigestFromProxyRequest(r); err == nil {
+		t.Errorf("NewDigestFromProxyRequest should fail for %q", "Basic")
+	}
+	// The headers are independent.
+	if _, err = NewBasicFromRequest(r); err == nil {
+		t.Errorf("NewBasicFromRequest should fail without an Authorization header")
+	}
+	r.Header.Del("Proxy-Authorization")
+	r.Header.Set("Authorization", "Basic "+v)
+	if _, err = NewBasicFromProxyRequest(r); err == nil {
+		t.Errorf("NewBasicFromProxyRequest should fail without a Proxy-Authorization header")
+	}
+	r.Header.Set("Proxy-Authorization", "Digest "+digestCredentials)
+	d, err := NewDigestFromProxyRequest(r)
+	if err != nil {
+		t.Errorf("NewDigestFromProxyRequest should not fail (error: %q)", err)
+	} else if d.Username != "Mufasa" {
+		t.Errorf("Expected username %q, got %q", "Mufasa", d.Username)
+	}
+}
+
+func TestDigestMissingParameters(t *testing.T) {
+	missing := []string{
+		"username", "realm", "nonce", "uri", "response", "nc", "cnonce",
+	}
+	for _, key := range missing {
+		var pairs []string
+		for _, pair := range strings.Split(digestCredentials, ", ") {
+			if !strings.HasPrefix(pair, key+"=") {
+				pairs = append(pairs, pair)
+			}
+		}
+		_, err := NewDigest(strings.Join(pairs, ", "))
+		if err == nil {
+			t.Errorf("NewDigest should fail without %q", key)
+		} else if !strings.Contains(err.Error(), `"`+key+`"`) {
+			t.Errorf("Expected error mentioning %q, got %q", key, err)
+		}
+	}
+}
+
+func TestDigestSessRequiresCnonce(t *testing.T) {
+	credentials := `username="Mufasa", realm="r", nonce="n", uri="/", response="x", algorithm=MD5-sess`
+	_, err := NewDigest(credentials)
+	if err == nil || !strings.Contains(err.Error(), `"cnonce"`) {
+		t.Errorf("Expected error mentioning %q, got %v", "cnonce", err)
+	}
+	d, err := NewDigest(credentials + `, cnonce="c"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.ComputeResponse("GET", "Circle Of Life"); err != nil {
+		t.Errorf("ComputeResponse should not fail (error: %q)", err)
+	}
+	d.Cnonce = ""
+	if _, err = d.ComputeResponse("GET", "Circle Of Life"); err == nil {
+		t.Errorf("ComputeResponse should fail without cnonce")
+	}
+}
+
+func TestDigestQuotedValues(t *testing.T) {
+	// Quoted strings can contain commas and escaped quotes, and interleave
+	// with unquoted tokens.
+	tests := []struct {
+		credentials string
+		realm       string
+	}{
+		{`realm="a,b", nonce=xyz`, `a,b`},
+		{`realm="say \"hi\", bye", nonce=xyz`, `say "hi", bye`},
+		{`nonce=xyz, realm="a\\,b"`, `a\,b`},
+		{`realm = "a, b" , nonce = xyz`, `a, b`},
+	}
+	for _, test := range tests {
+		d, err := NewDigest(`username="Mufasa", uri="/", response="r", ` +
+			test.credentials)
+		if err != nil {
+			t.Errorf("NewDigest should not fail for %q (error: %q)", test.credentials, err)
+			continue
+		}
+		if d.Realm != test.realm {
+			t.Errorf("Expected realm %q, got %q", test.realm, d.Realm)
+		}
+		if d.Nonce != "xyz" {
+			t.Errorf("Expected nonce %q, got %q", "xyz", d.Nonce)
+		}
+	}
+	// A Challenge quotes the realm so that it can be parsed back.
+	c := NewDigestChallenge(`say "hi", bye`, "xyz")
+	d, err := NewDigest(`username="Mufasa", uri="/", response="r", nc=1, cnonce=c, ` +
+		strings.TrimPrefix(c.String(), "Digest "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Realm != `say "hi", bye` || d.Nonce != "xyz" || d.Qop != "auth" {
+		t.Errorf("Expected the challenge parameters, got %+v", *d)
+	}
+}
+
+func TestDigestComputeResponse(t *testing.T) {
+	// Example from RFC 2617, section 3.5.
+	d, err := NewDigest(digestCredentials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := d.ComputeResponse("GET", "Circle Of Life")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != d.Response {
+		t.Errorf("Expected response %q, got %q", d.Response, response)
+	}
+	if ok, err := d.Verify("GET", "Circle Of Life"); !ok || err != nil {
+		t.Errorf("Verify should succeed (error: %v)", err)
+	}
+	if ok, err := d.Verify("GET", "Circle Of Death"); ok || err != nil {
+		t.Errorf("Verify should fail for a wrong password (error: %v)", err)
+	}
+	if ok, err := d.Verify("POST", "Circle Of Life"); ok || err != nil {
+		t.Errorf("Verify should fail for a wrong method (error: %v)", err)
+	}
+	// Without qop, as in RFC 2069.
+	d.Qop, d.Nc, d.Cnonce = "", "", ""
+	response, err = d.ComputeResponse("GET", "Circle Of Life")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != "670fd8c2df070c60b045671b8b24ff02" {
+		t.Errorf("Expected response %q, got %q", "670fd8c2df070c60b045671b8b24ff02", response)
+	}
+	// Unsupported values.
+	d.Qop = "auth-conf"
+	if _, err = d.ComputeResponse("GET", "Circle Of Life"); err == nil {
+		t.Errorf("ComputeResponse should fail for qop %q", d.Qop)
+	}
+	for _, algorithm := range []string{"SHA-512", "-sess", "MD5-sess-sess"} {
+		d.Qop, d.Algorithm = "", algorithm
+		if _, err = d.ComputeResponse("GET", "Circle Of Life"); err == nil {
+			t.Errorf("ComputeResponse should fail for algorithm %q", d.Algorithm)
+		}
+	}
+}
+
+func TestDigestSHA256(t *testing.T) {
+	// Examples from RFC 7616, section 3.9.1.
+	credentials := `username="Mufasa", realm="http-auth@example.org", ` +
+		`uri="/dir/index.html", nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", ` +
+		`qop=auth, nc=00000001, cnonce="f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", ` +
+		`opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS", response="-"`
+	d, err := NewDigest(credentials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		algorithm string
+		expected  string
+	}{
+		{"", "8ca523f5e9506fed4657c9700eebdbec"},
+		{"MD5", "8ca523f5e9506fed4657c9700eebdbec"},
+		{"SHA-256", "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+		{"sha-256", "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+		{"MD5-sess", "e783283f46242139c486a698fec7211d"},
+		{"SHA-256-sess", "2fd51b3a77ad75bad6afad6003e818d767133c46d9e2749e7f5232ae1ea3efd7"},
+	}
+	for _, test := range tests {
+		d.Algorithm = test.algorithm
+		response, err := d.ComputeResponse("GET", "Circle of Life")
+		if err != nil {
+			t.Errorf("ComputeResponse should not fail for algorithm %q (error: %q)", test.algorithm, err)
+		} else if response != test.expected {
+			t.Errorf("Expected response %q for algorithm %q, got %q", test.expected, test.algorithm, response)
+		}
+	}
+	d.Algorithm, d.Response = "SHA-256", tests[2].expected
+	if ok, err := d.Verify("GET", "Circle of Life"); !ok || err != nil {
+		t.Errorf("Verify should succeed (error: %v)", err)
+	}
+}
+
+func TestDigestAuthInt(t *testing.T) {
+	// The credentials from RFC 2617, section 3.5, with qop=auth-int.
+	d, err := NewDigest(digestCredentials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Qop = "auth-int"
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{"name=Mufasa&pride=lion", "5bb3aa2225d3688e50436ffb7c7d43a8"},
+		{"", "4bb0e26e65bdae3e89570d68fd7a073b"},
+	}
+	for _, test := range tests {
+		response, err := d.ComputeResponseWithBody("POST", "Circle Of Life",
+			strings.NewReader(test.body))
+		if err != nil {
+			t.Errorf("ComputeResponseWithBody should not fail for %q (error: %q)", test.body, err)
+		} else if response != test.expected {
+			t.Errorf("Expected response %q, got %q", test.expected, response)
+		}
+	}
+	d.Response = tests[0].expected
+	if ok, err := d.VerifyWithBody("POST", "Circle Of Life", strings.NewReader(tests[0].body)); !ok || err != nil {
+		t.Errorf("VerifyWithBody should succeed (error: %v)", err)
+	}
+	if ok, err := d.VerifyWithBody("POST", "Circle Of Life", strings.NewReader("tampered")); ok || err != nil {
+		t.Errorf("VerifyWithBody should fail for a wrong body (error: %v)", err)
+	}
+	// The body is required.
+	if _, err = d.ComputeResponse("POST", "Circle Of Life"); err == nil {
+		t.Errorf("ComputeResponse should fail for qop %q without a body", d.Qop)
+	}
+	// With qop=auth, the body is ignored.
+	d.Qop, d.Response = "auth", "6629fae49393a05397450978507c4ef1"
+	if ok, err := d.VerifyWithBody("GET", "Circle Of Life", strings.NewReader("ignored")); !ok || err != nil {
+		t.Errorf("VerifyWithBody should succeed for qop %q (error: %v)", d.Qop, err)
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	tests := []struct {
+		challenge *Challenge
+		expected  string
+	}{
+		{NewBasicChallenge("WallyWorld"), `Basic realm="WallyWorld"`},
+		{NewDigestChallenge("x", "y"), `Digest realm="x", nonce="y", qop="auth"`},
+		{NewBasicChallenge(`say "hi" \o/`), `Basic realm="say \"hi\" \\o/"`},
+		{&Challenge{
+			Scheme: "Digest",
+			Realm:  "testrealm@host.com",
+			Params: map[string]string{
+				"qop":    "auth,auth-int",
+				"nonce":  "dcd98b7102dd2f0e8b11d0f600bfb0c093",
+				"opaque": "5ccc069c403ebaf9f0171e9517f40e41",
+			},
+		}, `Digest realm="testrealm@host.com", ` +
+			`nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", ` +
+			`opaque="5ccc069c403ebaf9f0171e9517f40e41", qop="auth,auth-int"`},
+		// algorithm and stale are tokens; the realm is only written once.
+		{&Challenge{
+			Scheme: "Digest",
+			Realm:  "http-auth@example.org",
+			Params: map[string]string{
+				"algorithm": "SHA-256",
+				"nonce":     "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+				"stale":     "true",
+				"Realm":     "other",
+			},
+		}, `Digest realm="http-auth@example.org", algorithm=SHA-256, ` +
+			`nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", stale=true`},
+	}
+	for _, test := range tests {
+		if s := test.challenge.String(); s != test.expected {
+			t.Errorf("Expected %s, got %s", test.expected, s)
+		}
+	}
+}
+
+func TestBasicEncode(t *testing.T) {
+	tests := []Basic{
+		{"foo", "bar"},
+		{"foo", "bar:baz"},
+		{"Aladdin", "open sesame"},
+		{"", ""},
+	}
+	for _, b := range tests {
+		r, _ := http.NewRequest("GET", "http://localhost", nil)
+		b.SetAuthorization(r)
+		if h := r.Header.Get("Authorization"); h != b.Encode() {
+			t.Errorf("Expected header %q, got %q", b.Encode(), h)
+		}
+		decoded, err := NewBasicFromRequest(r)
+		if err != nil {
+			t.Errorf("NewBasicFromRequest should not fail for %q (error: %q)", b.Encode(), err)
+		} else if *decoded != b {
+			t.Errorf(`Expected "%s:%s", got "%s:%s"`, b.Username, b.Password, decoded.Username, decoded.Password)
+		}
+	}
+	// Example from RFC 2617, section 2.
+	b := &Basic{"Aladdin", "open sesame"}
+	if s := b.Encode(); s != "Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ==" {
+		t.Errorf("Expected %q, got %q", "Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ==", s)
+	}
+}
@@ -9,6 +9,8 @@ package parser
 
 import (
 	"bytes"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -16,6 +18,13 @@ import (
 //
 // Ported from urllib2.parse_http_list, from the Python standard library.
 func ParseList(value string) []string {
+	return parseList(value, true)
+}
+
+// parseList splits a comma-separated list of values. If unescape is false,
+// escaped characters in quoted strings are kept with their backslash, so
+// that the values can be split further.
+func parseList(value string, unescape bool) []string {
 	var list []string
 	var escape, quote bool
 	b := new(bytes.Buffer)
@@ -28,6 +37,9 @@ func ParseList(value string) []string {
 		if quote {
 			if r == '\\' {
 				escape = true
+				if !unescape {
+					b.WriteRune(r)
+				}
 				continue
 			} else if r == '"' {
 				quote = false
@@ -55,21 +67,251 @@ func ParseList(value string) []string {
 // ParsePairs extracts key/value pairs from a comma-separated list of values as
 // described by RFC 2068.
 //
-// The resulting values are unquoted. If a value doesn't contain a "=", the
-// key is the value itself and the value is an empty string.
+// The resulting values are unquoted, and escaped characters in quoted values
+// are unescaped by ParseList: `a="b\"c"` results in `b"c`. If a value doesn't
+// contain a "=", the key is the value itself and the value is an empty string.
 func ParsePairs(value string) map[string]string {
 	m := make(map[string]string)
 	for _, pair := range ParseList(value) {
-		if i := strings.Index(pair, "="); i < 0 {
-			m[pair] = ""
-		} else {
-			v := pair[i+1:]
-			if v[0] == '"' && v[len(v)-1] == '"' {
-				// Unquote it.
-				v = v[1:len(v)-1]
+		p := parsePair(pair)
+		m[p.Key] = p.Value
+	}
+	return m
+}
+
+// ParseOrderedPairs is like ParsePairs but returns the key/value pairs in the
+// order they appear, including repeated keys.
+func ParseOrderedPairs(value string) []Pair {
+	var pairs []Pair
+	for _, pair := range ParseList(value) {
+		pairs = append(pairs, parsePair(pair))
+	}
+	return pairs
+}
+
+// Pair is a key/value pair from a comma-separated list of values.
+type Pair struct {
+	Key   string
+	Value string
+}
+
+// parsePair splits a "key=value" pair, unquoting the value. Whitespace
+// around the "=" is allowed and ignored.
+func parsePair(pair string) Pair {
+	i := strings.Index(pair, "=")
+	if i < 0 {
+		return Pair{Key: pair}
+	}
+	v := strings.TrimSpace(pair[i+1:])
+	if len(v) > 1 && v[0] == '"' && v[len(v)-1] == '"' {
+		// Unquote it.
+		v = v[1 : len(v)-1]
+	}
+	return Pair{Key: strings.TrimSpace(pair[:i]), Value: v}
+}
+
+// parseParam is like parsePair for a parameter split from a list item that
+// was not unescaped: quoted values are unescaped too.
+func parseParam(param string) Pair {
+	p := parsePair(param)
+	if i := strings.Index(param, "="); i >= 0 && strings.HasPrefix(strings.TrimSpace(param[i+1:]), `"`) {
+		p.Value = unescapeQuoted(p.Value)
+	}
+	return p
+}
+
+// unescapeQuoted removes the backslashes escaping characters in the content
+// of a quoted string.
+func unescapeQuoted(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	b := new(bytes.Buffer)
+	escape := false
+	for _, r := range s {
+		if r == '\\' && !escape {
+			escape = true
+			continue
+		}
+		escape = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ParseAccept parses an "Accept" header value, or any other header using
+// quality values like "Accept-Language" and "Accept-Encoding", as described
+// by RFC 2616:
+//
+//	http://tools.ietf.org/html/rfc2616#section-14.1
+//
+// The values are sorted by descending quality. Values with the same quality
+// keep the order they had in the header.
+func ParseAccept(value string) []AcceptValue {
+	var values []AcceptValue
+	for _, item := range parseList(value, false) {
+		parts := splitParams(item)
+		v := AcceptValue{Value: parts[0], Q: 1}
+		for _, param := range parts[1:] {
+			p := parseParam(param)
+			key := strings.ToLower(strings.TrimSpace(p.Key))
+			if key == "q" {
+				v.Q = parseQuality(p.Value)
+				continue
 			}
-			m[pair[:i]] = v
+			if v.Params == nil {
+				v.Params = make(map[string]string)
+			}
+			v.Params[key] = strings.TrimSpace(p.Value)
 		}
+		values = append(values, v)
 	}
-	return m
+	sort.Stable(acceptByQ(values))
+	return values
+}
+
+// parseQuality parses a quality value as defined by RFC 7231:
+//
+//	qvalue = ( "0" [ "." 0*3DIGIT ] ) / ( "1" [ "." 0*3("0") ] )
+//
+// Invalid values result in 0.
+func parseQuality(s string) float64 {
+	if s == "" || len(s) > 5 || (s[0] != '0' && s[0] != '1') {
+		return 0
+	}
+	if len(s) > 1 {
+		if s[1] != '.' {
+			return 0
+		}
+		for _, r := range s[2:] {
+			if r < '0' || r > '9' || (s[0] == '1' && r != '0') {
+				return 0
+			}
+		}
+	}
+	q, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return q
+}
+
+// AcceptValue is a value from an "Accept" header with its parameters and
+// quality.
+type AcceptValue struct {
+	Value  string            // media range, language, encoding etc.
+	Params map[string]string // parameters, except the quality
+	Q      float64           // quality; 1 if not set
+}
+
+// acceptByQ sorts accept values by descending quality.
+type acceptByQ []AcceptValue
+
+func (a acceptByQ) Len() int           { return len(a) }
+func (a acceptByQ) Less(i, j int) bool { return a[i].Q > a[j].Q }
+func (a acceptByQ) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// splitParams splits a value from its semicolon-separated parameters, ignoring
+// semicolons inside quoted strings. The quoted strings must not have been
+// unescaped. The parts are trimmed.
+func splitParams(value string) []string {
+	var parts []string
+	var escape, quote bool
+	start := 0
+	for i, r := range value {
+		switch {
+		case escape:
+			escape = false
+		case r == '\\' && quote:
+			escape = true
+		case r == '"':
+			quote = !quote
+		case r == ';' && !quote:
+			parts = append(parts, strings.TrimSpace(value[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, strings.TrimSpace(value[start:]))
+}
+
+// ParseCacheControl parses a "Cache-Control" header value as described by
+// RFC 2616:
+//
+//	http://tools.ietf.org/html/rfc2616#section-14.9
+//
+// Directive names are case-insensitive and are stored in lower case.
+func ParseCacheControl(value string) CacheControl {
+	c := make(CacheControl)
+	for _, pair := range ParseList(value) {
+		p := parsePair(pair)
+		c[strings.ToLower(strings.TrimSpace(p.Key))] = strings.TrimSpace(p.Value)
+	}
+	return c
+}
+
+// CacheControl maps "Cache-Control" directives to their values. Directives
+// without a value, like no-cache, map to an empty string.
+type CacheControl map[string]string
+
+// Has returns true if the directive is set.
+func (c CacheControl) Has(directive string) bool {
+	_, ok := c[directive]
+	return ok
+}
+
+// Int returns the value of a delta-seconds directive like max-age. The
+// boolean is false if the directive is not set or its value is not a
+// non-negative integer.
+func (c CacheControl) Int(directive string) (int, bool) {
+	v, ok := c[directive]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// ParseLink parses a "Link" header value as described by RFC 8288:
+//
+//	http://tools.ietf.org/html/rfc8288#section-3
+//
+// Parameter names are case-insensitive and are stored in lower case. Values
+// that are not a URI reference enclosed in angle brackets are skipped.
+func ParseLink(value string) []Link {
+	var links []Link
+	list := parseList(value, false)
+	for i := 0; i < len(list); i++ {
+		item := list[i]
+		if !strings.HasPrefix(item, "<") {
+			continue
+		}
+		// The URI can contain commas, so join the parts split by ParseList.
+		for !strings.Contains(item, ">") && i+1 < len(list) {
+			i++
+			item += "," + list[i]
+		}
+		end := strings.Index(item, ">")
+		if end < 0 {
+			continue
+		}
+		link := Link{URI: item[1:end]}
+		for _, param := range splitParams(item[end+1:])[1:] {
+			p := parseParam(param)
+			if link.Params == nil {
+				link.Params = make(map[string]string)
+			}
+			link.Params[strings.ToLower(strings.TrimSpace(p.Key))] = strings.TrimSpace(p.Value)
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+// Link is a link from a "Link" header.
+type Link struct {
+	URI    string            // target URI reference, without the angle brackets
+	Params map[string]string // parameters, like rel or title
 }
@@ -5,6 +5,7 @@
 package parser
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -56,6 +57,14 @@ func TestParsePairs(t *testing.T) {
 	}{
 		{`a,b,c`, map[string]string{`a`: ``, `b`: ``, `c`: ``}},
 		{`a="b\"c", d="e\,f", g="h\\i"`, map[string]string{`a`: `b"c`, `d`: `e,f`, `g`: `h\i`}},
+		{`a=, b=c`, map[string]string{`a`: ``, `b`: `c`}},
+		{`a=b, c=`, map[string]string{`a`: `b`, `c`: ``}},
+		{`a=b, =`, map[string]string{`a`: `b`, ``: ``}},
+		{`a="`, map[string]string{`a`: `"`}},
+		{`a="b\\", c="\\\\"`, map[string]string{`a`: `b\`, `c`: `\\`}},
+		{`a="b\\\"c", d="\"e\""`, map[string]string{`a`: `b\"c`, `d`: `"e"`}},
+		{`a=b\c`, map[string]string{`a`: `b\c`}},
+		{`a = "b, c" , d =e`, map[string]string{`a`: `b, c`, `d`: `e`}},
 	}
 
 	for _, test := range tests {
@@ -65,3 +74,151 @@ func TestParsePairs(t *testing.T) {
 		}
 	}
 }
+
+func TestParseOrderedPairs(t *testing.T) {
+	tests := []struct {
+		Value string
+		Pairs []Pair
+	}{
+		{`a,b,a`, []Pair{{`a`, ``}, {`b`, ``}, {`a`, ``}}},
+		{`for=192.0.2.60, proto=http, for="198.51.100.17", by=203.0.113.43`, []Pair{
+			{`for`, `192.0.2.60`},
+			{`proto`, `http`},
+			{`for`, `198.51.100.17`},
+			{`by`, `203.0.113.43`},
+		}},
+		{`a=1, a=2, a="3,4"`, []Pair{{`a`, `1`}, {`a`, `2`}, {`a`, `3,4`}}},
+		{``, nil},
+	}
+
+	for _, test := range tests {
+		v := ParseOrderedPairs(test.Value)
+		if !reflect.DeepEqual(test.Pairs, v) {
+			t.Errorf("Expected %v, got %v", test.Pairs, v)
+		}
+	}
+}
+
+func TestParseAccept(t *testing.T) {
+	tests := []struct {
+		Value  string
+		Accept []AcceptValue
+	}{
+		{`text/html;q=0.9, */*;q=0.1`, []AcceptValue{
+			{`text/html`, nil, 0.9},
+			{`*/*`, nil, 0.1},
+		}},
+		{`*/*;q=0.1, text/html;q=0.9, application/json`, []AcceptValue{
+			{`application/json`, nil, 1},
+			{`text/html`, nil, 0.9},
+			{`*/*`, nil, 0.1},
+		}},
+		{`text/plain; q=0.5, text/html, text/x-dvi; q=0.8, text/x-c`, []AcceptValue{
+			{`text/html`, nil, 1},
+			{`text/x-c`, nil, 1},
+			{`text/x-dvi`, nil, 0.8},
+			{`text/plain`, nil, 0.5},
+		}},
+		{`text/html;level=1;Q=0.5, text/plain;format="a;b"`, []AcceptValue{
+			{`text/plain`, map[string]string{`format`: `a;b`}, 1},
+			{`text/html`, map[string]string{`level`: `1`}, 0.5},
+		}},
+		{`text/html; foo="x\";q=0.1", text/plain;bar="\\"`, []AcceptValue{
+			{`text/html`, map[string]string{`foo`: `x";q=0.1`}, 1},
+			{`text/plain`, map[string]string{`bar`: `\`}, 1},
+		}},
+		{`a;q=NaN, b;q=Inf, c;q=1e0, d;q=0x1p-1, e;q=0.0001, f;q=1.5, g;q=.5, h;q=0.5, i;q=1., j;q=1.000`, []AcceptValue{
+			{`i`, nil, 1},
+			{`j`, nil, 1},
+			{`h`, nil, 0.5},
+			{`a`, nil, 0},
+			{`b`, nil, 0},
+			{`c`, nil, 0},
+			{`d`, nil, 0},
+			{`e`, nil, 0},
+			{`f`, nil, 0},
+			{`g`, nil, 0},
+		}},
+		{`da, en-gb;q=foo, en;q=2`, []AcceptValue{
+			{`da`, nil, 1},
+			{`en-gb`, nil, 0},
+			{`en`, nil, 0},
+		}},
+	}
+
+	for _, test := range tests {
+		v := ParseAccept(test.Value)
+		if !reflect.DeepEqual(test.Accept, v) {
+			t.Errorf("Expected %v, got %v", test.Accept, v)
+		}
+	}
+}
+
+func TestParseCacheControl(t *testing.T) {
+	c := ParseCacheControl(`no-cache, max-age=0, private, S-MaxAge="600", no-store=""`)
+	expected := CacheControl{
+		`no-cache`: ``,
+		`max-age`:  `0`,
+		`private`:  ``,
+		`s-maxage`: `600`,
+		`no-store`: ``,
+	}
+	if !reflect.DeepEqual(expected, c) {
+		t.Errorf("Expected %v, got %v", expected, c)
+	}
+	for _, d := range []string{`no-cache`, `private`, `max-age`} {
+		if !c.Has(d) {
+			t.Errorf("Expected %q to be set", d)
+		}
+	}
+	if c.Has(`public`) {
+		t.Errorf("Expected %q not to be set", `public`)
+	}
+	ints := []struct {
+		Directive string
+		Value     int
+		Ok        bool
+	}{
+		{`max-age`, 0, true},
+		{`s-maxage`, 600, true},
+		{`no-cache`, 0, false},
+		{`public`, 0, false},
+	}
+	for _, test := range ints {
+		if v, ok := c.Int(test.Directive); v != test.Value || ok != test.Ok {
+			t.Errorf("%s: expected %d, %v, got %d, %v", test.Directive, test.Value, test.Ok, v, ok)
+		}
+	}
+}
+
+func TestParseLink(t *testing.T) {
+	tests := []struct {
+		Value string
+		Links []Link
+	}{
+		{`</a>; rel="next", </b>; rel="prev"; title="B"`, []Link{
+			{`/a`, map[string]string{`rel`: `next`}},
+			{`/b`, map[string]string{`rel`: `prev`, `title`: `B`}},
+		}},
+		{`<http://example.com/TheBook/chapter2>; REL=previous; title="previous; chapter"`, []Link{
+			{`http://example.com/TheBook/chapter2`, map[string]string{`rel`: `previous`, `title`: `previous; chapter`}},
+		}},
+		{`</a,b>;rel=next, </c>, garbage, </d>; title="x, y"`, []Link{
+			{`/a,b`, map[string]string{`rel`: `next`}},
+			{`/c`, nil},
+			{`/d`, map[string]string{`title`: `x, y`}},
+		}},
+		{`</a>; title="a\";b"; rel="next", </b>; title="c\\, d"`, []Link{
+			{`/a`, map[string]string{`title`: `a";b`, `rel`: `next`}},
+			{`/b`, map[string]string{`title`: `c\, d`}},
+		}},
+		{``, nil},
+	}
+
+	for _, test := range tests {
+		v := ParseLink(test.Value)
+		if !reflect.DeepEqual(test.Links, v) {
+			t.Errorf("Expected %v, got %v", test.Links, v)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package i18n
+
+// ChainCatalog is a Catalog that looks up translations in a list of
+// catalogs, in order. It is used to fall back to a base language when a
+// regional catalog misses a translation, e.g.:
+//
+//	c := ChainCatalog{ptBR, pt}
+//
+// When all catalogs miss, the key itself is used.
+type ChainCatalog []Catalog
+
+// Get returns the first non-empty translation for the given key, or the
+// key if no catalog has one.
+//
+// Extra arguments are optional, used to format the translation.
+func (c ChainCatalog) Get(key string, a ...interface{}) string {
+	for _, catalog := range c {
+		if s := catalog.Get(key, a...); s != "" {
+			return s
+		}
+	}
+	return format(key, a...)
+}
+
+// GetPlural returns the first non-empty plural translation for the given
+// key and number, or the key if no catalog has one.
+//
+// Extra arguments are optional, used to format the translation.
+func (c ChainCatalog) GetPlural(key string, num int, a ...interface{}) string {
+	for _, catalog := range c {
+		if s := catalog.GetPlural(key, num, a...); s != "" {
+			return s
+		}
+	}
+	return format(key, a...)
+}
+
+// NGet returns the first non-empty plural translation for the given number,
+// formatted with the number as the only argument, or the formatted source if
+// no catalog has one.
+func (c ChainCatalog) NGet(singular, plural string, num int) string {
+	for _, catalog := range c {
+		if s := catalog.GetPlural(singular, num, num); s != "" {
+			return s
+		}
+	}
+	return ngetSource(singular, plural, num)
+}
+
+// GetC returns the first non-empty translation for the given context and
+// key, or the key if no catalog has one.
+//
+// Extra arguments are optional, used to format the translation.
+func (c ChainCatalog) GetC(ctx, key string, a ...interface{}) string {
+	for _, catalog := range c {
+		if s := catalog.GetC(ctx, key, a...); s != "" {
+			return s
+		}
+	}
+	return format(key, a...)
+}
+
+// GetPluralC returns the first non-empty plural translation for the given
+// context, key and number, or the key if no catalog has one.
+//
+// Extra arguments are optional, used to format the translation.
+func (c ChainCatalog) GetPluralC(ctx, key string, num int, a ...interface{}) string {
+	for _, catalog := range c {
+		if s := catalog.GetPluralC(ctx, key, num, a...); s != "" {
+			return s
+		}
+	}
+	return format(key, a...)
+}
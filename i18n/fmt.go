@@ -0,0 +1,74 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package i18n
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// format formats a translation printf-style, leaving it untouched if there
+// are no arguments. Like in gettext, arguments can be reordered by position,
+// as in "%2$d bytes on %1$s.".
+func format(s string, a ...interface{}) string {
+	if len(a) == 0 {
+		return s
+	}
+	f, order := parseFmt(s)
+	if order == nil {
+		return fmt.Sprintf(s, a...)
+	}
+	// Positions are 1-based.
+	b := make([]interface{}, len(order))
+	for k, v := range order {
+		if v > 0 && v <= len(a) {
+			b[k] = a[v-1]
+		}
+	}
+	return fmt.Sprintf(f, b...)
+}
+
+// parseFmt converts a format with positional arguments to a standard one,
+// e.g. "%2$d bytes on %1$s." becomes "%d bytes on %s.", and returns the
+// position of the argument for each verb. Verbs without a position take the
+// next argument. The positions are nil if there are none in the format.
+func parseFmt(s string) (string, []int) {
+	var order []int
+	positional := false
+	next := 1
+	b := new(bytes.Buffer)
+	for i := 0; i < len(s); i++ {
+		b.WriteByte(s[i])
+		if s[i] != '%' {
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '%' {
+			b.WriteByte('%')
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+			j++
+		}
+		if j > i+1 && j < len(s) && s[j] == '$' {
+			n := 0
+			for _, c := range s[i+1 : j] {
+				n = n*10 + int(c-'0')
+			}
+			order = append(order, n)
+			next = n + 1
+			positional = true
+			i = j
+		} else {
+			order = append(order, next)
+			next++
+		}
+	}
+	if !positional {
+		return s, nil
+	}
+	return b.String(), order
+}
@@ -0,0 +1,51 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package i18n
+
+// TemplateFuncs returns a function map to translate messages in templates
+// using the given catalog:
+//
+//	T key [args...]
+//		Returns the translation for key, calling c.Get.
+//	TN singular plural n [args...]
+//		Returns the plural translation for n, calling c.GetPlural with
+//		the singular form as key.
+//	TC context key [args...]
+//		Returns the translation for key in the given context, calling
+//		c.GetC.
+//
+// If the catalog has no translation, the functions return the untranslated
+// text, choosing plural over singular when n is not 1, like ngettext does.
+// Extra arguments are used to format the result.
+//
+// The map can be passed to the Funcs method of sadbox/template sets and of
+// the standard text/template and html/template packages. The functions
+// return plain strings, so translations are escaped like any other data
+// by contextual escaping; a translation can't inject markup.
+func TemplateFuncs(c Catalog) map[string]interface{} {
+	return map[string]interface{}{
+		"T": func(key string, a ...interface{}) string {
+			if s := c.Get(key, a...); s != "" {
+				return s
+			}
+			return format(key, a...)
+		},
+		"TN": func(singular, plural string, n int, a ...interface{}) string {
+			if s := c.GetPlural(singular, n, a...); s != "" {
+				return s
+			}
+			if n == 1 {
+				return format(singular, a...)
+			}
+			return format(plural, a...)
+		},
+		"TC": func(ctx, key string, a ...interface{}) string {
+			if s := c.GetC(ctx, key, a...); s != "" {
+				return s
+			}
+			return format(key, a...)
+		},
+	}
+}
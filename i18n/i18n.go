@@ -16,4 +16,17 @@ type Catalog interface {
 	// normally just accept a key. To follow ngettext strictly,
 	// gettext-based catalogs must wrap a call to GetPlural.
 	GetPlural(key string, num int, a ...interface{}) string
+	// NGet returns a plural translation for the given number, formatted
+	// with the number as the only argument. The singular form is used as
+	// key. If there's no translation, the singular form is used when the
+	// number is 1 and the plural form otherwise, like ngettext does.
+	NGet(singular, plural string, num int) string
+	// GetC returns a translation for the given key in the given context,
+	// like pgettext does. Extra arguments are optional, used to format
+	// the translation.
+	GetC(ctx, key string, a ...interface{}) string
+	// GetPluralC returns a plural translation for the given key and number
+	// in the given context, like npgettext does. Extra arguments are
+	// optional, used to format the translation.
+	GetPluralC(ctx, key string, num int, a ...interface{}) string
 }
@@ -0,0 +1,246 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package i18n
+
+import (
+	"bytes"
+	"html/template"
+	"testing"
+
+	"code.google.com/p/sadbox/gettext/pluralforms"
+)
+
+func TestMapCatalog(t *testing.T) {
+	c := NewMapCatalog()
+	c.Messages["hello"] = "bonjour"
+	c.Messages["hello %s"] = "bonjour %s"
+	c.Plurals["%d apple"] = []string{"%d pomme", "%d pommes"}
+	c.Messages["%s of %s"] = "%2$s de %1$s"
+
+	var _ Catalog = c
+
+	tests := []struct {
+		got      string
+		expected string
+	}{
+		{c.Get("hello"), "bonjour"},
+		{c.Get("hello %s", "Marie"), "bonjour Marie"},
+		{c.Get("missing"), ""},
+		{c.Get("%s of %s", "page", "book"), "book de page"},
+		{c.GetPlural("%d apple", 1, 1), "1 pomme"},
+		{c.GetPlural("%d apple", 3, 3), "3 pommes"},
+		{c.GetPlural("%d apple", 0, 0), "0 pommes"},
+		{c.GetPlural("missing", 1), ""},
+	}
+	for _, test := range tests {
+		if test.got != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, test.got)
+		}
+	}
+
+	// French uses the singular for zero.
+	c.PluralFunc, _ = pluralforms.Parse("n>1")
+	if got := c.GetPlural("%d apple", 0, 0); got != "0 pomme" {
+		t.Errorf("expected %q, got %q", "0 pomme", got)
+	}
+	// Missing plural forms are handled as missing keys.
+	c.PluralFunc = func(int) int { return 2 }
+	if got := c.GetPlural("%d apple", 5, 5); got != "" {
+		t.Errorf("expected empty string, got %q", got)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		format   string
+		args     []interface{}
+		expected string
+	}{
+		{"%s of %s", []interface{}{"page", "book"}, "page of book"},
+		{"%2$s de %1$s", []interface{}{"page", "book"}, "book de page"},
+		{"%2$d%% of %1$s", []interface{}{"disk", 42}, "42% of disk"},
+		{"%1$s, %1$s", []interface{}{"ha"}, "ha, ha"},
+		{"%2$s %s", []interface{}{"a", "b", "c"}, "b c"},
+		{"100%", nil, "100%"},
+	}
+	for _, test := range tests {
+		if s := format(test.format, test.args...); s != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.format, test.expected, s)
+		}
+	}
+}
+
+func TestChainCatalog(t *testing.T) {
+	ptBR := NewMapCatalog()
+	ptBR.Messages["bus"] = "ônibus"
+	pt := NewMapCatalog()
+	pt.Messages["bus"] = "autocarro"
+	pt.Messages["train %d"] = "comboio %d"
+	pt.Plurals["%d day"] = []string{"%d dia", "%d dias"}
+
+	var c Catalog = ChainCatalog{ptBR, pt}
+
+	tests := []struct {
+		got      string
+		expected string
+	}{
+		{c.Get("bus"), "ônibus"},
+		{c.Get("train %d", 7), "comboio 7"},
+		{c.Get("plane"), "plane"},
+		{c.Get("plane %d", 3), "plane 3"},
+		{c.GetPlural("%d day", 2, 2), "2 dias"},
+		{c.GetPlural("%d week", 2, 2), "2 week"},
+	}
+	for _, test := range tests {
+		if test.got != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, test.got)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	accept := "fr-CH, fr;q=0.9, en;q=0.8"
+	tests := []struct {
+		accept    string
+		available []string
+		expected  string
+	}{
+		{accept, []string{"en", "fr", "fr-CH"}, "fr-CH"},
+		{accept, []string{"en", "fr-ch"}, "fr-ch"},
+		{accept, []string{"en", "fr"}, "fr"},
+		{accept, []string{"en", "fr-FR"}, "fr-FR"},
+		{accept, []string{"de", "en-US"}, "en-US"},
+		{accept, []string{"de", "pt"}, ""},
+		{accept, nil, ""},
+		{"", []string{"en"}, ""},
+		{"de, *;q=0.5", []string{"en", "fr"}, "en"},
+		{"fr;q=0, en;q=0.1", []string{"fr", "en"}, "en"},
+		{"fr;q=0", []string{"fr"}, ""},
+		{"fr;q=0, *", []string{"fr", "en"}, "en"},
+		{"fr;q=0, *", []string{"fr-CH", "fr"}, ""},
+		{"fr-CH;q=0, *", []string{"fr-CH", "fr"}, "fr"},
+		{"fr;q=0, fr-CH, *", []string{"fr", "fr-CH"}, "fr-CH"},
+		{"fr", []string{"fra"}, ""},
+	}
+	for _, test := range tests {
+		if got := Negotiate(test.accept, test.available); got != test.expected {
+			t.Errorf("%q %v: expected %q, got %q", test.accept, test.available, test.expected, got)
+		}
+	}
+}
+
+func TestGetC(t *testing.T) {
+	base := NewMapCatalog()
+	base.Messages["food"] = "comida"
+	base.Messages[ContextKey("slang", "food")] = "rango"
+	kids := NewMapCatalog()
+	kids.Messages[ContextKey("kids", "food")] = "merenda"
+	kids.Plurals[ContextKey("kids", "%d toy")] = []string{"%d brinquedo", "%d brinquedos"}
+
+	c := ChainCatalog{kids, base}
+
+	tests := []struct {
+		got      string
+		expected string
+	}{
+		{base.GetC("slang", "food"), "rango"},
+		{base.GetC("kids", "food"), ""},
+		{kids.GetPluralC("kids", "%d toy", 2, 2), "2 brinquedos"},
+		{kids.GetPlural("%d toy", 2, 2), ""},
+		{c.GetC("kids", "food"), "merenda"},
+		{c.GetC("slang", "food"), "rango"},
+		{c.GetC("other", "food"), "food"},
+		{c.GetPluralC("kids", "%d toy", 1, 1), "1 brinquedo"},
+		{c.GetPluralC("slang", "%d toy", 2, 2), "2 toy"},
+	}
+	for _, test := range tests {
+		if test.got != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, test.got)
+		}
+	}
+}
+
+func TestNGet(t *testing.T) {
+	pt := NewMapCatalog()
+	pt.Plurals["%d file"] = []string{"%d arquivo", "%d arquivos"}
+
+	tests := []struct {
+		got      string
+		expected string
+	}{
+		{pt.NGet("%d file", "%d files", 1), "1 arquivo"},
+		{pt.NGet("%d file", "%d files", 3), "3 arquivos"},
+		{pt.NGet("%d dir", "%d dirs", 1), "1 dir"},
+		{pt.NGet("%d dir", "%d dirs", 3), "3 dirs"},
+		{ChainCatalog{NewMapCatalog(), pt}.NGet("%d file", "%d files", 3), "3 arquivos"},
+		{ChainCatalog{pt}.NGet("%d dir", "%d dirs", 0), "0 dirs"},
+	}
+	for _, test := range tests {
+		if test.got != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, test.got)
+		}
+	}
+}
+
+func TestNumberFormat(t *testing.T) {
+	en := NumberFormats["en-US"]
+	de := NumberFormats["de-DE"]
+	tests := []struct {
+		got      string
+		expected string
+	}{
+		{en.Format(1234.56), "1,234.56"},
+		{de.Format(1234.56), "1.234,56"},
+		{en.Format(-1234567.5), "-1,234,567.5"},
+		{de.Format(-1234567.5), "-1.234.567,5"},
+		{en.Format(999), "999"},
+		{en.Format(0.25), "0.25"},
+		{en.Format(100000), "100,000"},
+		{en.FormatInt(1234567), "1,234,567"},
+		{de.FormatInt(1234567), "1.234.567"},
+		{de.FormatInt(-123), "-123"},
+		{de.FormatInt(-9223372036854775808), "-9.223.372.036.854.775.808"},
+		{NumberFormats["fr-FR"].Format(1234.5), "1\u202f234,5"},
+		{NumberFormat{}.Format(1234.5), "1234.5"},
+		{NumberFormat{Decimal: ",", Group: " ", GroupSize: 4}.FormatInt(123456789), "1 2345 6789"},
+	}
+	for _, test := range tests {
+		if test.got != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, test.got)
+		}
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	c := NewMapCatalog()
+	c.Messages["Hello, %s"] = "Olá, %s"
+	c.Messages[ContextKey("month", "May")] = "Maio"
+	c.Plurals["%d file"] = []string{"%d arquivo", "%d arquivos"}
+
+	tmpl, err := template.New("t").Funcs(TemplateFuncs(c)).Parse(
+		`{{T "Hello, %s" .Name}}|{{T "100%"}}|` +
+			`{{TN "%d file" "%d files" .N .N}}|{{TN "%d dir" "%d dirs" .N .N}}|` +
+			`{{TC "month" "May"}}|{{TC "verb" "May"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		data     map[string]interface{}
+		expected string
+	}{
+		{map[string]interface{}{"Name": "<Ana>", "N": 1},
+			"Olá, &lt;Ana&gt;|100%|1 arquivo|1 dir|Maio|May"},
+		{map[string]interface{}{"Name": "Rui", "N": 3},
+			"Olá, Rui|100%|3 arquivos|3 dirs|Maio|May"},
+	}
+	for _, test := range tests {
+		b := new(bytes.Buffer)
+		if err := tmpl.Execute(b, test.data); err != nil {
+			t.Errorf("exec error: %s", err)
+		} else if b.String() != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, b.String())
+		}
+	}
+}
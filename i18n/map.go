@@ -0,0 +1,101 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package i18n
+
+import (
+	"code.google.com/p/sadbox/gettext/pluralforms"
+)
+
+// NewMapCatalog returns a new MapCatalog, initializing internal fields.
+func NewMapCatalog() *MapCatalog {
+	return &MapCatalog{
+		Messages:   make(map[string]string),
+		Plurals:    make(map[string][]string),
+		PluralFunc: pluralforms.DefaultPluralFunc,
+	}
+}
+
+// MapCatalog is an in-memory Catalog backed by maps.
+//
+// Plural translations are stored as a slice of forms, selected using
+// PluralFunc. Translations with a context are stored using the key returned
+// by ContextKey.
+type MapCatalog struct {
+	Messages   map[string]string      // translations
+	Plurals    map[string][]string    // plural translations
+	PluralFunc pluralforms.PluralFunc // used to select the plural form index
+}
+
+// Get returns a translation for the given key, or an empty string if the
+// key is not found.
+//
+// Extra arguments are optional, used to format the translation.
+func (c *MapCatalog) Get(key string, a ...interface{}) string {
+	if s, ok := c.Messages[key]; ok {
+		return format(s, a...)
+	}
+	return ""
+}
+
+// GetPlural returns a plural translation for the given key and number,
+// or an empty string if the key or the plural form is not found.
+//
+// Extra arguments are optional, used to format the translation.
+func (c *MapCatalog) GetPlural(key string, num int, a ...interface{}) string {
+	forms, ok := c.Plurals[key]
+	if !ok {
+		return ""
+	}
+	fn := c.PluralFunc
+	if fn == nil {
+		fn = pluralforms.DefaultPluralFunc
+	}
+	if idx := fn(num); idx >= 0 && idx < len(forms) {
+		return format(forms[idx], a...)
+	}
+	return ""
+}
+
+// NGet returns a plural translation for the given number, formatted with
+// the number as the only argument, or the formatted source if the key is
+// not found.
+func (c *MapCatalog) NGet(singular, plural string, num int) string {
+	if s := c.GetPlural(singular, num, num); s != "" {
+		return s
+	}
+	return ngetSource(singular, plural, num)
+}
+
+// GetC returns a translation for the given context and key, or an empty
+// string if the key is not found.
+//
+// Extra arguments are optional, used to format the translation.
+func (c *MapCatalog) GetC(ctx, key string, a ...interface{}) string {
+	return c.Get(ContextKey(ctx, key), a...)
+}
+
+// GetPluralC returns a plural translation for the given context, key and
+// number, or an empty string if the key or the plural form is not found.
+//
+// Extra arguments are optional, used to format the translation.
+func (c *MapCatalog) GetPluralC(ctx, key string, num int, a ...interface{}) string {
+	return c.GetPlural(ContextKey(ctx, key), num, a...)
+}
+
+// ContextKey returns the key used to store a translation with a context in
+// a MapCatalog. Like in MO files, the context and the key are joined by
+// an EOT character (\x04).
+func ContextKey(ctx, key string) string {
+	return ctx + "\x04" + key
+}
+
+// ngetSource returns the untranslated source for NGet, choosing between the
+// singular and plural forms like ngettext does.
+func ngetSource(singular, plural string, num int) string {
+	if num == 1 {
+		return format(singular, num)
+	}
+	return format(plural, num)
+}
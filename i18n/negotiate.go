@@ -0,0 +1,72 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package i18n
+
+import (
+	"strings"
+
+	"code.google.com/p/sadbox/http/parser"
+)
+
+// Negotiate returns the available language tag that best matches an
+// "Accept-Language" header value, or an empty string if none matches.
+//
+// Language ranges are tried by descending quality and matched using the
+// basic filtering described in RFC 4647:
+//
+//	http://tools.ietf.org/html/rfc4647#section-3.3.1
+//
+// A range matches a tag if it is equal to the tag or to a prefix of it
+// followed by "-", ignoring case, so "fr" matches "fr-CH" but "fr-CH"
+// doesn't match "fr". The wildcard "*" matches any tag, except the ones
+// matched by a range with a quality of zero, like "fr" in "fr;q=0, *".
+// Ranges with a quality of zero are never matched.
+func Negotiate(accept string, available []string) string {
+	values := parser.ParseAccept(accept)
+	var excluded []string
+	for _, v := range values {
+		if v.Q == 0 && v.Value != "*" {
+			excluded = append(excluded, v.Value)
+		}
+	}
+	for _, v := range values {
+		if v.Q == 0 {
+			continue
+		}
+		for _, tag := range available {
+			if !matchLanguage(v.Value, tag) {
+				continue
+			}
+			if v.Value == "*" && matchAny(excluded, tag) {
+				continue
+			}
+			return tag
+		}
+	}
+	return ""
+}
+
+// matchAny reports whether any of the language ranges matches a language
+// tag.
+func matchAny(lranges []string, tag string) bool {
+	for _, lrange := range lranges {
+		if matchLanguage(lrange, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchLanguage reports whether a language range matches a language tag
+// using RFC 4647 basic filtering.
+func matchLanguage(lrange, tag string) bool {
+	if lrange == "*" {
+		return true
+	}
+	if len(tag) < len(lrange) || !strings.EqualFold(tag[:len(lrange)], lrange) {
+		return false
+	}
+	return len(tag) == len(lrange) || tag[len(lrange)] == '-'
+}
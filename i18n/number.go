@@ -0,0 +1,84 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package i18n
+
+import (
+	"strconv"
+	"strings"
+)
+
+// NumberFormats has number formats for a few common locales, keyed by
+// language tag. Tags returned by Negotiate can be used to look them up.
+var NumberFormats = map[string]NumberFormat{
+	"en-US": {Decimal: ".", Group: ",", GroupSize: 3},
+	"en-GB": {Decimal: ".", Group: ",", GroupSize: 3},
+	"de-DE": {Decimal: ",", Group: ".", GroupSize: 3},
+	"fr-FR": {Decimal: ",", Group: "\u202f", GroupSize: 3},
+	"pt-BR": {Decimal: ",", Group: ".", GroupSize: 3},
+	"de-CH": {Decimal: ".", Group: "\u2019", GroupSize: 3},
+}
+
+// NumberFormat formats numbers with locale-specific separators, e.g.
+// 1,234.56 in English or 1.234,56 in German.
+//
+// The zero value writes numbers without grouping and with "." as the
+// decimal separator.
+type NumberFormat struct {
+	Decimal   string // decimal separator; "." if empty
+	Group     string // separator between groups of digits in the integer part
+	GroupSize int    // number of digits per group; 0 disables grouping
+}
+
+// Format returns n formatted with the separators. The fractional part uses
+// the fewest digits needed to represent n exactly, so 1234.5 is formatted as
+// "1,234.5" in English. Infinities and NaN are formatted as by strconv.
+func (f NumberFormat) Format(n float64) string {
+	s := strconv.FormatFloat(n, 'f', -1, 64)
+	if s == "NaN" || strings.HasSuffix(s, "Inf") {
+		return s
+	}
+	frac := ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		s, frac = s[:i], s[i+1:]
+	}
+	s = f.group(s)
+	if frac == "" {
+		return s
+	}
+	decimal := f.Decimal
+	if decimal == "" {
+		decimal = "."
+	}
+	return s + decimal + frac
+}
+
+// FormatInt returns n formatted with the group separators.
+func (f NumberFormat) FormatInt(n int64) string {
+	return f.group(strconv.FormatInt(n, 10))
+}
+
+// group inserts the group separator in a string of digits with an optional
+// leading minus sign.
+func (f NumberFormat) group(s string) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	if f.GroupSize <= 0 || f.Group == "" || len(s) <= f.GroupSize {
+		return sign + s
+	}
+	var b strings.Builder
+	b.WriteString(sign)
+	first := len(s) % f.GroupSize
+	if first == 0 {
+		first = f.GroupSize
+	}
+	b.WriteString(s[:first])
+	for i := first; i < len(s); i += f.GroupSize {
+		b.WriteString(f.Group)
+		b.WriteString(s[i : i+f.GroupSize])
+	}
+	return b.String()
+}
@@ -21,6 +21,10 @@ of the differences:
 	  skeleton templates to be filled by other templates. This must be
 	  familiar to Python developers because it is similar to what Django,
 	  Jinja2 or Mako provide through template inheritance.
+	- A new builtin function, include, executes a template whose name is
+	  only known at run time, e.g. {{include .PartialName .}}.
+	- The {{break}} and {{continue}} actions end the innermost {{range}}
+	  loop or skip to its next iteration.
 
 The rest is basically the same, the grammar is the same, and the syntax is the
 same, as it is built on top of the zen foundations from these packages:
@@ -118,6 +118,7 @@ var attrTypeMap = map[string]contentType{
 	"sizes":       contentTypePlain,
 	"span":        contentTypePlain,
 	"src":         contentTypeURL,
+	"srcset":      contentTypeSrcset,
 	"srcdoc":      contentTypeHTML,
 	"srclang":     contentTypePlain,
 	"start":       contentTypePlain,
@@ -102,6 +102,8 @@ const (
 	stateAttr
 	// stateURL occurs inside an HTML attribute whose content is a URL.
 	stateURL
+	// stateSrcset occurs inside an HTML srcset attribute.
+	stateSrcset
 	// stateJS occurs inside an event handler or script element.
 	stateJS
 	// stateJSDqStr occurs inside a JavaScript double quoted string.
@@ -114,6 +116,10 @@ const (
 	stateJSBlockCmt
 	// stateJSLineCmt occurs inside a JavaScript // line comment.
 	stateJSLineCmt
+	// stateJSON occurs inside a <script type="application/json"> element.
+	stateJSON
+	// stateJSONDqStr occurs inside a JSON double quoted string.
+	stateJSONDqStr
 	// stateCSS occurs inside a <style> element or style attribute.
 	stateCSS
 	// stateCSSDqStr occurs inside a CSS double quoted string.
@@ -130,6 +136,8 @@ const (
 	stateCSSBlockCmt
 	// stateCSSLineCmt occurs inside a CSS // line comment.
 	stateCSSLineCmt
+	// stateDead marks unreachable code after a {{break}} or {{continue}}.
+	stateDead
 	// stateError is an infectious error state outside any valid
 	// HTML/CSS/JS construct.
 	stateError
@@ -145,12 +153,15 @@ var stateNames = [...]string{
 	stateRCDATA:      "stateRCDATA",
 	stateAttr:        "stateAttr",
 	stateURL:         "stateURL",
+	stateSrcset:      "stateSrcset",
 	stateJS:          "stateJS",
 	stateJSDqStr:     "stateJSDqStr",
 	stateJSSqStr:     "stateJSSqStr",
 	stateJSRegexp:    "stateJSRegexp",
 	stateJSBlockCmt:  "stateJSBlockCmt",
 	stateJSLineCmt:   "stateJSLineCmt",
+	stateJSON:        "stateJSON",
+	stateJSONDqStr:   "stateJSONDqStr",
 	stateCSS:         "stateCSS",
 	stateCSSDqStr:    "stateCSSDqStr",
 	stateCSSSqStr:    "stateCSSSqStr",
@@ -159,6 +170,7 @@ var stateNames = [...]string{
 	stateCSSURL:      "stateCSSURL",
 	stateCSSBlockCmt: "stateCSSBlockCmt",
 	stateCSSLineCmt:  "stateCSSLineCmt",
+	stateDead:        "stateDead",
 	stateError:       "stateError",
 }
 
@@ -293,6 +305,9 @@ const (
 	elementTextarea
 	// elementTitle corresponds to the RCDATA <title> element.
 	elementTitle
+	// elementJSON corresponds to a raw text <script> element whose type
+	// is JSON, e.g. <script type="application/json">.
+	elementJSON
 )
 
 var elementNames = [...]string{
@@ -301,6 +316,7 @@ var elementNames = [...]string{
 	elementStyle:    "elementStyle",
 	elementTextarea: "elementTextarea",
 	elementTitle:    "elementTitle",
+	elementJSON:     "elementJSON",
 }
 
 func (e element) String() string {
@@ -322,13 +338,20 @@ const (
 	attrStyle
 	// attrURL corresponds to an attribute whose value is a URL.
 	attrURL
+	// attrSrcset corresponds to a srcset attribute.
+	attrSrcset
+	// attrScriptType corresponds to the type attribute of a <script>
+	// element, whose value decides how the element content is escaped.
+	attrScriptType
 )
 
 var attrNames = [...]string{
-	attrNone:   "attrNone",
-	attrScript: "attrScript",
-	attrStyle:  "attrStyle",
-	attrURL:    "attrURL",
+	attrNone:       "attrNone",
+	attrScript:     "attrScript",
+	attrStyle:      "attrStyle",
+	attrURL:        "attrURL",
+	attrSrcset:     "attrSrcset",
+	attrScriptType: "attrScriptType",
 }
 
 func (a attr) String() string {
@@ -14,6 +14,9 @@ type Error struct {
 	ErrorCode ErrorCode
 	// Name is the name of the template in which the error was encountered.
 	Name string
+	// ParseName is the name of the input the template with the error was
+	// parsed from, e.g. a file name, or empty.
+	ParseName string
 	// Line is the line number of the error in the template source or 0.
 	Line int
 	// Description is a human-readable description of the problem.
@@ -182,7 +185,9 @@ const (
 )
 
 func (e *Error) Error() string {
-	if e.Line != 0 {
+	if e.Line != 0 && e.ParseName != "" {
+		return fmt.Sprintf("html/template:%s:%d: %s", e.ParseName, e.Line, e.Description)
+	} else if e.Line != 0 {
 		return fmt.Sprintf("html/template:%s:%d: %s", e.Name, e.Line, e.Description)
 	} else if e.Name != "" {
 		return fmt.Sprintf("html/template:%s: %s", e.Name, e.Description)
@@ -193,5 +198,5 @@ func (e *Error) Error() string {
 // errorf creates an error given a format string f and args.
 // The template Name still needs to be supplied.
 func errorf(k ErrorCode, line int, f string, args ...interface{}) *Error {
-	return &Error{k, "", line, fmt.Sprintf(f, args...)}
+	return &Error{k, "", "", line, fmt.Sprintf(f, args...)}
 }
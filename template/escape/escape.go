@@ -12,9 +12,25 @@ import (
 	"code.google.com/p/sadbox/template/parse"
 )
 
-// EscapeTree rewrites the given template tree to guarantee that the output
-// of any template is properly escaped. If no error is returned, then the tree
-// has been modified.  Otherwise the tree is cleaned and became unusable.
+// EscapeTree rewrites the templates in the given tree to guarantee that
+// their output is contextually escaped. It is the entry point used by
+// template.Set.Escape, and can be called directly on any tree produced by
+// parse.Parse, e.g. by packages that generate templates.
+//
+// The tree is modified in place and returned. Escaping may add templates
+// derived from the original ones, to be called in contexts other than HTML
+// text. The rewritten actions call the functions in FuncMap, which must be
+// available when the tree is executed:
+//
+//	tree, err := escape.EscapeTree(tree)
+//	if err != nil {
+//		// the tree is unusable...
+//	}
+//	set := &template.Set{Tree: tree}
+//	set.Funcs(escape.FuncMap)
+//
+// If an error is returned, all templates are removed from the tree, so that
+// unsafe templates can't be executed. The error is an *Error.
 func EscapeTree(tree parse.Tree) (parse.Tree, error) {
 	e := newEscaper(tree)
 	for name, _ := range tree {
@@ -23,7 +39,7 @@ func EscapeTree(tree parse.Tree) (parse.Tree, error) {
 		if c.err != nil {
 			err, c.err.Name = c.err, name
 		} else if c.state != stateText {
-			err = &Error{ErrEndContext, name, 0, fmt.Sprintf("ends in a non-text context: %v", c)}
+			err = &Error{ErrEndContext, name, "", 0, fmt.Sprintf("ends in a non-text context: %v", c)}
 		}
 		if err != nil {
 			// Remove all, preventing execution of unsafe templates.
@@ -45,11 +61,14 @@ var FuncMap = map[string]interface{}{
 	"html_template_cssvaluefilter":  cssValueFilter,
 	"html_template_htmlnamefilter":  htmlNameFilter,
 	"html_template_htmlescaper":     htmlEscaper,
+	"html_template_jsonstrescaper":  jsonStrEscaper,
+	"html_template_jsonvalescaper":  jsonValEscaper,
 	"html_template_jsregexpescaper": jsRegexpEscaper,
 	"html_template_jsstrescaper":    jsStrEscaper,
 	"html_template_jsvalescaper":    jsValEscaper,
 	"html_template_nospaceescaper":  htmlNospaceEscaper,
 	"html_template_rcdataescaper":   rcdataEscaper,
+	"html_template_srcsetescaper":   srcsetFilterAndEscaper,
 	"html_template_urlescaper":      urlEscaper,
 	"html_template_urlfilter":       urlFilter,
 	"html_template_urlnormalizer":   urlNormalizer,
@@ -83,6 +102,16 @@ type escaper struct {
 	actionNodeEdits   map[*parse.ActionNode][]string
 	templateNodeEdits map[*parse.TemplateNode]string
 	textNodeEdits     map[*parse.TextNode][]byte
+	// rangeContext holds the contexts at the {{break}} and {{continue}}
+	// actions of the innermost range being escaped.
+	rangeContext *rangeContext
+}
+
+// rangeContext holds the contexts at the loop control actions of a range.
+type rangeContext struct {
+	outer     *rangeContext // the enclosing range, or nil
+	breaks    []context     // the context at each {{break}}
+	continues []context     // the context at each {{continue}}
 }
 
 // newEscaper creates a blank escaper for the given set.
@@ -95,6 +124,7 @@ func newEscaper(tree parse.Tree) *escaper {
 		map[*parse.ActionNode][]string{},
 		map[*parse.TemplateNode]string{},
 		map[*parse.TextNode][]byte{},
+		nil,
 	}
 }
 
@@ -126,6 +156,12 @@ func (e *escaper) escape(c context, n parse.Node) context {
 		return e.escapeList(c, n.List)
 	case *parse.FillNode:
 		return e.escapeList(c, n.List)
+	case *parse.BreakNode:
+		e.rangeContext.breaks = append(e.rangeContext.breaks, c)
+		return context{state: stateDead}
+	case *parse.ContinueNode:
+		e.rangeContext.continues = append(e.rangeContext.continues, c)
+		return context{state: stateDead}
 	}
 	panic("escaping " + n.String() + " is unimplemented")
 }
@@ -163,6 +199,12 @@ func (e *escaper) escapeAction(c context, n *parse.ActionNode) context {
 		default:
 			panic(c.urlPart.String())
 		}
+	case stateSrcset:
+		s = append(s, "html_template_srcsetescaper")
+	case stateJSON:
+		s = append(s, "html_template_jsonvalescaper")
+	case stateJSONDqStr:
+		s = append(s, "html_template_jsonstrescaper")
 	case stateJS:
 		s = append(s, "html_template_jsvalescaper")
 		// A slash after a value starts a div operator.
@@ -355,6 +397,13 @@ func join(a, b context, line int, nodeName string) context {
 	if b.state == stateError {
 		return b
 	}
+	// Unreachable code joins with anything.
+	if a.state == stateDead {
+		return b
+	}
+	if b.state == stateDead {
+		return a
+	}
 	if a.eq(b) {
 		return a
 	}
@@ -394,13 +443,27 @@ func join(a, b context, line int, nodeName string) context {
 
 // escapeBranch escapes a branch template node: "if", "range" and "with".
 func (e *escaper) escapeBranch(c context, n *parse.BranchNode, nodeName string) context {
+	if nodeName == "range" {
+		e.rangeContext = &rangeContext{outer: e.rangeContext}
+	}
 	c0 := e.escapeList(c, n.List)
-	if nodeName == "range" && c0.state != stateError {
+	if nodeName == "range" {
+		// The loop ends or starts over at {{break}} and {{continue}}.
+		c0 = e.joinRange(c0, n.Line)
+		if c0.state == stateError {
+			return c0
+		}
 		// The "true" branch of a "range" node can execute multiple times.
 		// We check that executing n.List once results in the same context
 		// as executing n.List twice.
+		e.rangeContext = &rangeContext{outer: e.rangeContext}
 		c1, _ := e.escapeListConditionally(c0, n.List, nil)
 		c0 = join(c0, c1, n.Line, nodeName)
+		if c0.state != stateError {
+			c0 = e.joinRange(c0, n.Line)
+		} else {
+			e.rangeContext = e.rangeContext.outer
+		}
 		if c0.state == stateError {
 			// Make clear that this is a problem on loop re-entry
 			// since developers tend to overlook that branch when
@@ -414,6 +477,29 @@ func (e *escaper) escapeBranch(c context, n *parse.BranchNode, nodeName string)
 	return join(c0, c1, n.Line, nodeName)
 }
 
+// joinRange joins the context at the end of the innermost range body with
+// the contexts at its {{break}} and {{continue}} actions, and pops the range.
+func (e *escaper) joinRange(c context, line int) context {
+	rc := e.rangeContext
+	e.rangeContext = rc.outer
+	if c.state == stateError {
+		return c
+	}
+	for _, c1 := range rc.breaks {
+		if c = join(c, c1, line, "range"); c.state == stateError {
+			c.err.Description = "at {{break}}: " + c.err.Description
+			return c
+		}
+	}
+	for _, c1 := range rc.continues {
+		if c = join(c, c1, line, "range"); c.state == stateError {
+			c.err.Description = "at {{continue}}: " + c.err.Description
+			return c
+		}
+	}
+	return c
+}
+
 // escapeList escapes a list template node.
 func (e *escaper) escapeList(c context, n *parse.ListNode) context {
 	if n == nil {
@@ -421,6 +507,10 @@ func (e *escaper) escapeList(c context, n *parse.ListNode) context {
 	}
 	for _, m := range n.Nodes {
 		c = e.escape(c, m)
+		if c.state == stateDead {
+			// The rest of the list is unreachable.
+			break
+		}
 	}
 	return c
 }
@@ -431,6 +521,7 @@ func (e *escaper) escapeList(c context, n *parse.ListNode) context {
 // which is the same as whether e was updated.
 func (e *escaper) escapeListConditionally(c context, n *parse.ListNode, filter func(*escaper, context) bool) (context, bool) {
 	e1 := newEscaper(e.tmpl)
+	e1.rangeContext = e.rangeContext
 	// Make type inferences available to f.
 	for k, v := range e.output {
 		e1.output[k] = v
@@ -532,6 +623,10 @@ func (e *escaper) computeOutCtx(c context, t *parse.DefineNode) context {
 			err: errorf(ErrOutputContext, 0, "cannot compute output context for template %s", t.Name),
 		}
 	}
+	if c1.state == stateError && c1.err.ParseName == "" {
+		// Lines are relative to the input of the innermost template.
+		c1.err.ParseName = t.ParseName
+	}
 	return c1
 }
 
@@ -688,13 +783,17 @@ func contextAfterText(c context, s []byte) (context, int) {
 		}
 		return c, len(s)
 	}
+	element := c.element
+	if c.attr == attrScriptType && element == elementScript && isJSONType(string(s[:i])) {
+		element = elementJSON
+	}
 	if c.delim != delimSpaceOrTagEnd {
 		// Consume any quote.
 		i++
 	}
 	// On exiting an attribute, we discard all state information
 	// except the state and element.
-	return context{state: stateTag, element: c.element}, i
+	return context{state: stateTag, element: element}, i
 }
 
 // editActionNode records a change to an action pipeline for later commit.
@@ -5,6 +5,7 @@
 package escape
 
 import (
+	"strings"
 	"testing"
 
 	"code.google.com/p/sadbox/template/parse"
@@ -44,6 +45,38 @@ func TestRedundantFuncs(t *testing.T) {
 	}
 }
 
+func TestEscapeTree(t *testing.T) {
+	tree, err := parse.Parse(`{{define "t"}}<a href="{{.X}}">{{.Y}}</a>{{end}}`, "test", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := EscapeTree(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := got["t"].String()
+	for _, want := range []string{
+		"{{.X | html_template_urlfilter | html_template_urlnormalizer | html_template_attrescaper}}",
+		"{{.Y | html_template_htmlescaper}}",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("escaped tree: want\n\t%s\nin\n\t%s", want, s)
+		}
+	}
+
+	// Failures empty the tree.
+	tree, err = parse.Parse(`{{define "t"}}<a href="{{.X}}{{end}}`, "test", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = EscapeTree(tree); err == nil || !strings.Contains(err.Error(), "non-text context") {
+		t.Errorf("expected a non-text context error, got %v", err)
+	}
+	if len(tree) != 0 {
+		t.Errorf("expected an empty tree after an error, got %d templates", len(tree))
+	}
+}
+
 func TestEscapeText(t *testing.T) {
 	tests := []struct {
 		input  string
@@ -118,6 +151,70 @@ func TestEscapeText(t *testing.T) {
 			`<a href=''`,
 			context{state: stateTag},
 		},
+		{
+			`<template>`,
+			context{state: stateText},
+		},
+		{
+			`<template><a href="`,
+			context{state: stateURL, delim: delimDoubleQuote},
+		},
+		{
+			`<template><script>`,
+			context{state: stateJS, element: elementScript},
+		},
+		{
+			`<template><script>x</script>`,
+			context{state: stateText},
+		},
+		{
+			`<template><p title="</template>`,
+			context{state: stateAttr, delim: delimDoubleQuote},
+		},
+		{
+			`<template><textarea></template>`,
+			context{state: stateRCDATA, element: elementTextarea},
+		},
+		{
+			`<template><p>x</p></template>`,
+			context{state: stateText},
+		},
+		{
+			`<script type="application/json`,
+			context{state: stateAttr, delim: delimDoubleQuote, element: elementScript, attr: attrScriptType},
+		},
+		{
+			`<script type="text/javascript">`,
+			context{state: stateJS, element: elementScript},
+		},
+		{
+			`<script type="application/json">`,
+			context{state: stateJSON, element: elementJSON},
+		},
+		{
+			`<script type=application/json>{"a": "`,
+			context{state: stateJSONDqStr, element: elementJSON},
+		},
+		{
+			`<script type='application/json; charset=utf-8'>{"a": "\"}`,
+			context{state: stateJSONDqStr, element: elementJSON},
+		},
+		{
+			`<script type="application/json">{"a": "b"}`,
+			context{state: stateJSON, element: elementJSON},
+		},
+		{
+			`<script type="application/json">{"a": "b"}</script>`,
+			context{},
+		},
+		{
+			`<img srcset=`,
+			context{state: stateBeforeValue, attr: attrSrcset},
+		},
+		{
+			`<img srcset="a.png 1x, `,
+			context{state: stateSrcset, delim: delimDoubleQuote, urlPart: urlPartPreQuery},
+		},
 		{
 			`<a href= "`,
 			context{state: stateURL, delim: delimDoubleQuote},
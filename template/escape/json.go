@@ -0,0 +1,69 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package escape
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// jsonTypes are the script types whose content is JSON.
+var jsonTypes = map[string]bool{
+	"application/json":    true,
+	"application/ld+json": true,
+}
+
+// isJSONType reports whether the value of a script element's type attribute
+// declares JSON content. Parameters like "; charset=utf-8" are ignored.
+func isJSONType(mimeType string) bool {
+	if i := strings.IndexRune(mimeType, ';'); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	return jsonTypes[strings.ToLower(strings.TrimSpace(mimeType))]
+}
+
+// jsonValEscaper escapes its inputs to a JSON value that can be embedded in
+// a <script type="application/json"> element.
+//
+// The output never contains '<', '>' or '&' so it can't end the element
+// early with "</script" or start an HTML comment.
+func jsonValEscaper(args ...interface{}) string {
+	var a interface{}
+	if len(args) == 1 {
+		a = indirectToJSONMarshaler(args[0])
+		switch t := a.(type) {
+		case json.Marshaler:
+			// Do not treat as a Stringer.
+		case fmt.Stringer:
+			a = t.String()
+		}
+	} else {
+		for i, arg := range args {
+			args[i] = indirectToJSONMarshaler(arg)
+		}
+		a = fmt.Sprint(args...)
+	}
+	b, err := json.Marshal(a)
+	if err != nil || len(b) == 0 {
+		// JSON has no comments to report the error in.
+		return "null"
+	}
+	// json.Marshal escapes HTML specials, including in the output of
+	// custom marshalers, as \u003c, \u003e and \u0026.
+	return string(b)
+}
+
+// jsonStrEscaper escapes its inputs so they can be embedded in a JSON string
+// inside a <script type="application/json"> element.
+func jsonStrEscaper(args ...interface{}) string {
+	s, _ := stringify(args...)
+	b, err := json.Marshal(s)
+	if err != nil {
+		return ""
+	}
+	// Strip the quotes.
+	return string(b[1 : len(b)-1])
+}
@@ -23,12 +23,15 @@ var transitionFunc = [...]func(context, []byte) (context, int){
 	stateRCDATA:      tSpecialTagEnd,
 	stateAttr:        tAttr,
 	stateURL:         tURL,
+	stateSrcset:      tURL,
 	stateJS:          tJS,
 	stateJSDqStr:     tJSDelimited,
 	stateJSSqStr:     tJSDelimited,
 	stateJSRegexp:    tJSDelimited,
 	stateJSBlockCmt:  tBlockCmt,
 	stateJSLineCmt:   tLineCmt,
+	stateJSON:        tJSON,
+	stateJSONDqStr:   tJSONDqStr,
 	stateCSS:         tCSS,
 	stateCSSDqStr:    tCSSStr,
 	stateCSSSqStr:    tCSSStr,
@@ -80,6 +83,7 @@ var elementContentType = [...]state{
 	elementStyle:    stateCSS,
 	elementTextarea: stateRCDATA,
 	elementTitle:    stateRCDATA,
+	elementJSON:     stateJSON,
 }
 
 // tTag is the context transition function for the tag state.
@@ -109,11 +113,16 @@ func tTag(c context, s []byte) (context, int) {
 	switch attrType(string(s[i:j])) {
 	case contentTypeURL:
 		attr = attrURL
+	case contentTypeSrcset:
+		attr = attrSrcset
 	case contentTypeCSS:
 		attr = attrStyle
 	case contentTypeJS:
 		attr = attrScript
 	}
+	if c.element == elementScript && strings.EqualFold(string(s[i:j]), "type") {
+		attr = attrScriptType
+	}
 	if j == len(s) {
 		state = stateAttrName
 	} else {
@@ -150,10 +159,12 @@ func tAfterName(c context, s []byte) (context, int) {
 }
 
 var attrStartStates = [...]state{
-	attrNone:   stateAttr,
-	attrScript: stateJS,
-	attrStyle:  stateCSS,
-	attrURL:    stateURL,
+	attrNone:       stateAttr,
+	attrScript:     stateJS,
+	attrStyle:      stateCSS,
+	attrURL:        stateURL,
+	attrSrcset:     stateSrcset,
+	attrScriptType: stateAttr,
 }
 
 // tBeforeValue is the context transition function for stateBeforeValue.
@@ -170,7 +181,11 @@ func tBeforeValue(c context, s []byte) (context, int) {
 	case '"':
 		delim, i = delimDoubleQuote, i+1
 	}
-	c.state, c.delim, c.attr = attrStartStates[c.attr], delim, attrNone
+	c.state, c.delim = attrStartStates[c.attr], delim
+	if c.attr != attrScriptType {
+		// Only the script type is needed once the value ends.
+		c.attr = attrNone
+	}
 	return c, i
 }
 
@@ -189,6 +204,7 @@ var specialTagEndMarkers = [...]string{
 	elementStyle:    "</style",
 	elementTextarea: "</textarea",
 	elementTitle:    "</title",
+	elementJSON:     "</script",
 }
 
 // tSpecialTagEnd is the context transition function for raw text and RCDATA
@@ -219,6 +235,30 @@ func tURL(c context, s []byte) (context, int) {
 	return c, len(s)
 }
 
+// tJSON is the context transition function for the JSON state.
+func tJSON(c context, s []byte) (context, int) {
+	i := bytes.IndexByte(s, '"')
+	if i == -1 {
+		return c, len(s)
+	}
+	c.state = stateJSONDqStr
+	return c, i + 1
+}
+
+// tJSONDqStr is the context transition function for the JSON string state.
+func tJSONDqStr(c context, s []byte) (context, int) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			c.state = stateJSON
+			return c, i + 1
+		}
+	}
+	return c, len(s)
+}
+
 // tJS is the context transition function for the JS state.
 func tJS(c context, s []byte) (context, int) {
 	i := bytes.IndexAny(s, `"'/`)
@@ -500,6 +540,9 @@ func eatAttrName(s []byte, i int) (int, *Error) {
 	return len(s), nil
 }
 
+// elementNameMap maps the names of elements whose content is not normal HTML
+// to their element type. Other elements, including the inert <template>
+// element whose content is parsed as normal markup, are elementNone.
 var elementNameMap = map[string]element{
 	"script":   elementScript,
 	"style":    elementStyle,
@@ -13,17 +13,51 @@ import (
 // urlFilter returns its input unless it contains an unsafe protocol in which
 // case it defangs the entire URL.
 func urlFilter(args ...interface{}) string {
+	return filterURL(isSafeURL, args...)
+}
+
+// URLFilterFuncs returns escaping functions that filter URLs using a custom
+// policy: allowed reports whether a URL is safe to output. URLs it rejects
+// are replaced by "#ZgotmplZ". Content of type URL is trusted and is not
+// passed to allowed.
+//
+// The functions have the same names as the URL filters in FuncMap, so
+// they can be added after FuncMap to replace the default policy, which only
+// allows relative URLs and the http, https and mailto protocols.
+func URLFilterFuncs(allowed func(url string) bool) map[string]interface{} {
+	return map[string]interface{}{
+		"html_template_urlfilter": func(args ...interface{}) string {
+			return filterURL(allowed, args...)
+		},
+		"html_template_srcsetescaper": func(args ...interface{}) string {
+			return filterSrcset(allowed, args...)
+		},
+	}
+}
+
+// filterURL returns its input unless allowed rejects it, in which case it
+// defangs the entire URL.
+func filterURL(allowed func(string) bool, args ...interface{}) string {
 	s, t := stringify(args...)
 	if t == contentTypeURL {
 		return s
 	}
+	if !allowed(s) {
+		return "#" + filterFailsafe
+	}
+	return s
+}
+
+// isSafeURL is true if s is a relative URL or if it has a protocol in
+// (http, https, mailto).
+func isSafeURL(s string) bool {
 	if i := strings.IndexRune(s, ':'); i >= 0 && strings.IndexRune(s[:i], '/') < 0 {
 		protocol := strings.ToLower(s[:i])
 		if protocol != "http" && protocol != "https" && protocol != "mailto" {
-			return "#" + filterFailsafe
+			return false
 		}
 	}
-	return s
+	return true
 }
 
 // urlEscaper produces an output that can be embedded in a URL query.
@@ -103,3 +137,88 @@ func urlProcessor(norm bool, args ...interface{}) string {
 	b.WriteString(s[written:])
 	return b.String()
 }
+
+// srcsetFilterAndEscaper filters and normalizes the value of a srcset
+// attribute: a comma separated list of image candidates, each a URL
+// optionally followed by a width or density descriptor, as in
+// "a.png 1x, b.png 2x". Each URL is filtered and normalized while the
+// descriptors and separating commas are preserved. Candidates with an unsafe
+// URL or a malformed descriptor are replaced by "#ZgotmplZ".
+func srcsetFilterAndEscaper(args ...interface{}) string {
+	return filterSrcset(isSafeURL, args...)
+}
+
+// filterSrcset is srcsetFilterAndEscaper using allowed to filter URLs.
+func filterSrcset(allowed func(string) bool, args ...interface{}) string {
+	s, t := stringify(args...)
+	if t == contentTypeURL {
+		// A URL is a single candidate, so commas in it must not be
+		// taken as separators.
+		return strings.Replace(urlProcessor(true, s), ",", "%2c", -1)
+	}
+	var b bytes.Buffer
+	written := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == ',' {
+			filterSrcsetElement(allowed, s, written, i, &b)
+			b.WriteString(",")
+			written = i + 1
+		}
+	}
+	filterSrcsetElement(allowed, s, written, len(s), &b)
+	return b.String()
+}
+
+// filterSrcsetElement writes the filtered srcset candidate s[left:right]
+// to b.
+func filterSrcsetElement(allowed func(string) bool, s string, left, right int, b *bytes.Buffer) {
+	start := left
+	for start < right && isHTMLSpace(s[start]) {
+		start++
+	}
+	end := right
+	for end > start && isHTMLSpace(s[end-1]) {
+		end--
+	}
+	if start == end {
+		// An empty candidate, e.g. after a trailing comma.
+		b.WriteString(s[left:right])
+		return
+	}
+	url := s[start:end]
+	descriptor := ""
+	if i := strings.IndexAny(url, " \t\n\f\r"); i >= 0 {
+		url, descriptor = url[:i], url[i:]
+	}
+	if allowed(url) && isSrcsetDescriptor(descriptor) {
+		b.WriteString(s[left:start])
+		b.WriteString(urlProcessor(true, url))
+		b.WriteString(descriptor)
+		b.WriteString(s[end:right])
+		return
+	}
+	b.WriteString("#")
+	b.WriteString(filterFailsafe)
+}
+
+// isSrcsetDescriptor reports whether s only contains the characters allowed
+// in srcset width and density descriptors, e.g. " 100w" or " 1.5x".
+func isSrcsetDescriptor(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !isHTMLSpace(c) && c != '.' && !isAlphaNum(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// isHTMLSpace reports whether c is a space character as defined by HTML5.
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+// isAlphaNum reports whether c is an ASCII letter or digit.
+func isAlphaNum(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
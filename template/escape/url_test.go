@@ -5,6 +5,7 @@
 package escape
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -35,6 +36,54 @@ func TestURLNormalizer(t *testing.T) {
 	}
 }
 
+func TestSrcsetFilter(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"", ""},
+		{"a.png", "a.png"},
+		{"a.png 1x, b.png 2x", "a.png 1x, b.png 2x"},
+		{" a.png\t100w ,b.png 1.5x", " a.png\t100w ,b.png 1.5x"},
+		{"a.png 1x;", "#ZgotmplZ"},
+		{"a|b.png 1x", "a%7cb.png 1x"},
+		{"javascript:alert(1) 1x, b.png 2x", "#ZgotmplZ, b.png 2x"},
+		{"a.png 1x,", "a.png 1x,"},
+	}
+	for _, test := range tests {
+		if got := srcsetFilterAndEscaper(test.input); got != test.want {
+			t.Errorf("%q: want\n\t%q\nbut got\n\t%q", test.input, test.want, got)
+		}
+	}
+	// URL-typed content is a single candidate.
+	if got, want := srcsetFilterAndEscaper(URL("a.png?x=1,2")), "a.png?x=1%2c2"; got != want {
+		t.Errorf("URL content: want %q but got %q", want, got)
+	}
+}
+
+func TestURLFilterFuncs(t *testing.T) {
+	funcs := URLFilterFuncs(func(url string) bool {
+		return strings.HasPrefix(url, "https:")
+	})
+	filter := funcs["html_template_urlfilter"].(func(...interface{}) string)
+	srcset := funcs["html_template_srcsetescaper"].(func(...interface{}) string)
+	tests := []struct {
+		input, url, srcset string
+	}{
+		{"https://a/b.png", "https://a/b.png", "https://a/b.png"},
+		{"http://a/b.png", "#ZgotmplZ", "#ZgotmplZ"},
+		{"b.png", "#ZgotmplZ", "#ZgotmplZ"},
+		{"https://a/b.png 1x, data:x 2x", "https://a/b.png 1x, data:x 2x", "https://a/b.png 1x,#ZgotmplZ"},
+	}
+	for _, test := range tests {
+		if got := filter(test.input); got != test.url {
+			t.Errorf("urlfilter %q: want %q but got %q", test.input, test.url, got)
+		}
+		if got := srcset(test.input); got != test.srcset {
+			t.Errorf("srcsetescaper %q: want %q but got %q", test.input, test.srcset, got)
+		}
+	}
+}
+
 func TestURLFilters(t *testing.T) {
 	input := ("\x00\x01\x02\x03\x04\x05\x06\x07\x08\t\n\x0b\x0c\r\x0e\x0f" +
 		"\x10\x11\x12\x13\x14\x15\x16\x17\x18\x19\x1a\x1b\x1c\x1d\x1e\x1f" +
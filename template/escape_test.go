@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -108,6 +109,16 @@ func TestEscape(t *testing.T) {
 			"{{range .E}}{{.}}{{else}}{{.H}}{{end}}",
 			"&lt;Hello&gt;",
 		},
+		{
+			"rangeBreak",
+			"{{range .A}}<b>{{.}}{{break}}</b>{{end}}",
+			"<b>&lt;a&gt;",
+		},
+		{
+			"rangeContinue",
+			"{{range .A}}<b>{{.}}</b>{{continue}}<i>{{end}}",
+			"<b>&lt;a&gt;</b><b>&lt;b&gt;</b>",
+		},
 		{
 			"nonStringValue",
 			"{{.T}}",
@@ -640,6 +651,31 @@ func TestEscape(t *testing.T) {
 			`<h{{3}}><table><t{{"head"}}>...</h{{3}}>`,
 			`<h3><table><thead>...</h3>`,
 		},
+		{
+			"templateElement",
+			`<template><p title="{{.C}}">{{.H}}</p><a href="{{.G}}">x</a><script>var x = {{.C}}</script></template><b>{{.G}}</b>`,
+			`<template><p title="&lt;Cincinatti&gt;">&lt;Hello&gt;</p><a href="%3cGoodbye%3e">x</a><script>var x = "\u003cCincinatti\u003e"</script></template><b>&lt;Goodbye&gt;</b>`,
+		},
+		{
+			"jsonValue",
+			`<script type="application/json">{"c": {{.C}}, "n": {{.N}}, "a": {{.A}}}</script>`,
+			`<script type="application/json">{"c": "\u003cCincinatti\u003e", "n": 42, "a": ["\u003ca\u003e","\u003cb\u003e"]}</script>`,
+		},
+		{
+			"jsonStr",
+			`<script type="application/json">{"c": "{{.C}} \"{{.G}}\""}</script>`,
+			`<script type="application/json">{"c": "\u003cCincinatti\u003e \"\u003cGoodbye\u003e\""}</script>`,
+		},
+		{
+			"jsonMarshaler",
+			`<script type='application/json; charset=utf-8'>{{.M}}</script><p>{{.C}}`,
+			`<script type='application/json; charset=utf-8'>{"\u003cfoo\u003e":"O'Reilly"}</script><p>&lt;Cincinatti&gt;`,
+		},
+		{
+			"jsonScriptBreakout",
+			`<script type="application/json">{{"</script><script>alert(1)</script>"}}</script>`,
+			`<script type="application/json">"\u003c/script\u003e\u003cscript\u003ealert(1)\u003c/script\u003e"</script>`,
+		},
 		{
 			"bad dynamic element name",
 			// Dynamic element names are typically used to switch
@@ -912,6 +948,14 @@ func TestErrors(t *testing.T) {
 			"\n{{range .Items}} x='<a{{end}}",
 			": on range loop re-entry: {{range}} branches",
 		},
+		{
+			"{{range .Items}}<a{{if .X}}{{break}}{{end}}>{{end}}",
+			": at {{break}}: {{range}} branches",
+		},
+		{
+			"{{range .Items}}<b>{{if .X}}{{continue}}{{end}}<a{{end}}",
+			": at {{continue}}: {{range}} branches",
+		},
 		{
 			"<a b=1 c={{.H}}",
 			": ends in a non-text context: {stateAttr delimSpaceOrTagEnd",
@@ -1023,6 +1067,63 @@ func TestErrors(t *testing.T) {
 	}
 }
 
+func TestErrorPosition(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"page.html": "{{define \"page\"}}\n<p>\n{{if .}}<a href=\"{{else}}<b>{{end}}\n</p>{{end}}",
+		"part.html": "{{define \"part\"}}\n\n\n<a href=\"{{if .}}/a?b={{end}}{{.}}\">{{end}}",
+		"main.html": "{{define \"main\"}}\n<p>{{template \"part\"}}</p>{{end}}",
+	}
+	tests := []struct {
+		filenames []string
+		err       string
+	}{
+		{
+			[]string{"page.html"},
+			"page.html:3: {{if}} branches end in different contexts",
+		},
+		{
+			[]string{"part.html"},
+			"part.html:4: {{.}} appears in an ambiguous URL context",
+		},
+		{
+			// The position is in the called template.
+			[]string{"main.html", "part.html"},
+			"part.html:4: {{.}} appears in an ambiguous URL context",
+		},
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, test := range tests {
+		var filenames []string
+		for _, name := range test.filenames {
+			filenames = append(filenames, filepath.Join(dir, name))
+		}
+		set, err := ParseFiles(filenames...)
+		if err != nil {
+			t.Errorf("%v: unexpected parse error %s", test.filenames, err)
+			continue
+		}
+		_, err = set.Escape()
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%v: expected error containing %q, got %v", test.filenames, test.err, err)
+		}
+	}
+
+	// Templates parsed from strings are reported like parse errors.
+	set, err := Parse("{{define \"t\"}}\n{{if .}}<a{{end}}{{end}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = set.Escape()
+	if want := "html/template:source:2: {{if}} branches"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("expected error containing %q, got %v", want, err)
+	}
+}
+
 func TestEscapeErrorsNotIgnorable(t *testing.T) {
 	set, err := Parse(`{{define "t"}}<a{{end}}`)
 	if err != nil {
@@ -1057,6 +1158,144 @@ func TestEscapeSetErrorsNotIgnorable(t *testing.T) {
 	}
 }
 
+func TestEscapeTwice(t *testing.T) {
+	set, err := Parse(`{{define "t"}}<a href="{{.}}">{{.}}</a>{{end}}`)
+	if err != nil {
+		t.Fatalf("failed to parse set: %q", err)
+	}
+	if _, err = set.Escape(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if _, err = set.Escape(); err == nil || !strings.Contains(err.Error(), "already escaped") {
+		t.Errorf("Expected error escaping twice; got %v", err)
+	}
+	_, err = set.Parse(`{{define "u"}}{{.}}{{end}}`)
+	if err == nil || !strings.Contains(err.Error(), "after escaping") {
+		t.Errorf("Expected error parsing after escaping; got %v", err)
+	}
+	if set.Lookup("u") {
+		t.Errorf("Expected template %q not to be added", "u")
+	}
+	clone, err := set.Clone()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if _, err = clone.Escape(); err == nil {
+		t.Errorf("Expected error escaping a clone of an escaped set")
+	}
+	// The content is escaped only once.
+	if got := set.MustExecute("t", "<&>"); got != `<a href="%3c&amp;%3e">&lt;&amp;&gt;</a>` {
+		t.Errorf("Unexpected output %q", got)
+	}
+}
+
+func TestEscapeSrcset(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		output string
+	}{
+		{
+			"a.png",
+			"b.png",
+			`<img srcset="a.png 1x, b.png 2x">`,
+		},
+		{
+			"/img/a|b.png",
+			"http://example.com/b.png?x=1&y=2",
+			`<img srcset="/img/a%7cb.png 1x, http://example.com/b.png?x=1&amp;y=2 2x">`,
+		},
+		{
+			// Each candidate is filtered on its own.
+			"javascript:alert(1)",
+			"b.png 100w, data:x 200w",
+			`<img srcset="#ZgotmplZ 1x, b.png 100w,#ZgotmplZ 2x">`,
+		},
+		{
+			// Descriptors only allow alphanumerics.
+			"a.png 1x\"",
+			"b.png",
+			`<img srcset="#ZgotmplZ 1x, b.png 2x">`,
+		},
+	}
+	set, err := Parse(`{{define "t"}}<img srcset="{{.A}} 1x, {{.B}} 2x">{{end}}`)
+	if err != nil {
+		t.Fatalf("failed to parse set: %q", err)
+	}
+	if _, err = set.Escape(); err != nil {
+		t.Fatalf("failed to escape set: %q", err)
+	}
+	for _, test := range tests {
+		got, err := set.ExecuteString("t", struct{ A, B string }{test.a, test.b})
+		if err != nil {
+			t.Errorf("%q, %q: template execution failed: %s", test.a, test.b, err)
+			continue
+		}
+		if got != test.output {
+			t.Errorf("%q, %q: escaped output: want\n\t%q\ngot\n\t%q", test.a, test.b, test.output, got)
+		}
+	}
+}
+
+func TestURLFilter(t *testing.T) {
+	httpsOnly := func(url string) bool {
+		return strings.HasPrefix(strings.ToLower(url), "https:")
+	}
+	set, err := Parse(`{{define "t"}}<a href="{{.}}"><img srcset="{{.}} 2x" style="background: url({{.}})"></a>{{end}}`)
+	if err != nil {
+		t.Fatalf("failed to parse set: %q", err)
+	}
+	if _, err = set.URLFilter(httpsOnly).Escape(); err != nil {
+		t.Fatalf("failed to escape set: %q", err)
+	}
+	tests := []struct {
+		input  interface{}
+		output string
+	}{
+		{
+			"https://example.com/a.png",
+			`<a href="https://example.com/a.png"><img srcset="https://example.com/a.png 2x" style="background: url(https://example.com/a.png)"></a>`,
+		},
+		{
+			"http://example.com/a.png",
+			`<a href="#ZgotmplZ"><img srcset="#ZgotmplZ 2x" style="background: url(#ZgotmplZ)"></a>`,
+		},
+		{
+			"javascript:alert(1)",
+			`<a href="#ZgotmplZ"><img srcset="#ZgotmplZ 2x" style="background: url(#ZgotmplZ)"></a>`,
+		},
+		{
+			"/a.png",
+			`<a href="#ZgotmplZ"><img srcset="#ZgotmplZ 2x" style="background: url(#ZgotmplZ)"></a>`,
+		},
+		{
+			// Typed URLs are trusted.
+			escape.URL("/a.png"),
+			`<a href="/a.png"><img srcset="/a.png 2x" style="background: url(/a.png)"></a>`,
+		},
+	}
+	for _, test := range tests {
+		got, err := set.ExecuteString("t", test.input)
+		if err != nil {
+			t.Errorf("%q: template execution failed: %s", test.input, err)
+			continue
+		}
+		if got != test.output {
+			t.Errorf("%q: escaped output: want\n\t%q\ngot\n\t%q", test.input, test.output, got)
+		}
+	}
+	// The default policy is unchanged for other sets.
+	set, err = Parse(`{{define "t"}}<a href="{{.}}">{{end}}`)
+	if err != nil {
+		t.Fatalf("failed to parse set: %q", err)
+	}
+	if _, err = set.Escape(); err != nil {
+		t.Fatalf("failed to escape set: %q", err)
+	}
+	if got := set.MustExecute("t", "/a.png"); got != `<a href="/a.png">` {
+		t.Errorf("default filter: unexpected output %q", got)
+	}
+}
+
 func TestIndirectPrint(t *testing.T) {
 	a := 3
 	ap := &a
@@ -1103,3 +1342,46 @@ func BenchmarkEscapedExecute(b *testing.B) {
 		buf.Reset()
 	}
 }
+
+func TestEscapeSafeHTML(t *testing.T) {
+	// Pre-sanitized fragments are marked with escape.HTML, by the caller or
+	// by a function, and are written verbatim in HTML text.
+	const fragment = `<p class="x">Fish &amp; chips</p>`
+	set, err := new(Set).Funcs(FuncMap{
+		"sanitized": func(s string) escape.HTML { return escape.HTML(s) },
+	}).Parse(`
+{{define "data"}}<div>{{.}}</div>{{end}}
+{{define "func"}}<div>{{sanitized .}}</div>{{end}}
+{{define "include"}}<div>{{include "data" .}}</div>{{end}}
+{{define "attr"}}<div title="{{.}}"></div>{{end}}
+`)
+	if err != nil {
+		t.Fatalf("failed to parse set: %q", err)
+	}
+	if _, err = set.Escape(); err != nil {
+		t.Fatalf("failed to escape set: %q", err)
+	}
+	tests := []struct {
+		name   string
+		data   interface{}
+		output string
+	}{
+		{"data", escape.HTML(fragment), `<div>` + fragment + `</div>`},
+		{"func", fragment, `<div>` + fragment + `</div>`},
+		{"include", escape.HTML(fragment), `<div><div>` + fragment + `</div></div>`},
+		// Plain strings are still escaped.
+		{"data", fragment, `<div>&lt;p class=&#34;x&#34;&gt;Fish &amp;amp; chips&lt;/p&gt;</div>`},
+		// In attributes, tags are stripped but entities are not re-escaped.
+		{"attr", escape.HTML(fragment), `<div title="Fish &amp; chips"></div>`},
+	}
+	for _, test := range tests {
+		got, err := set.ExecuteString(test.name, test.data)
+		if err != nil {
+			t.Errorf("%s: template execution failed: %s", test.name, err)
+			continue
+		}
+		if got != test.output {
+			t.Errorf("%s: want\n\t%q\ngot\n\t%q", test.name, test.output, got)
+		}
+	}
+}
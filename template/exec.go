@@ -5,13 +5,16 @@
 package template
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"reflect"
 	"runtime"
 	"sort"
 	"strings"
+	"sync/atomic"
 
+	"code.google.com/p/sadbox/template/escape"
 	"code.google.com/p/sadbox/template/parse"
 )
 
@@ -25,6 +28,7 @@ type state struct {
 	vars    []variable        // push-down stack of variable values
 	fillers map[string]filler // registered fill nodes
 	filling bool              // true when we are executing a fill node
+	depth   int               // the height of the stack of executing templates
 }
 
 // filler holds a block node used as filler and a dot value to evaluate it.
@@ -112,7 +116,7 @@ func errRecover(errp *error) {
 // Execute applies the template with the given name to the specified data
 // object and writes the output to wr.
 func (s *Set) Execute(wr io.Writer, name string, data interface{}) (err error) {
-	s.init()
+	s.markExecuted()
 	tmpl := s.Tree[name]
 	if tmpl == nil {
 		return fmt.Errorf("template: template %q not defined", name)
@@ -132,6 +136,48 @@ func (s *Set) Execute(wr io.Writer, name string, data interface{}) (err error) {
 	return
 }
 
+// markExecuted records the first execution of the set. Once it returns,
+// Funcs can't modify the function maps read during execution.
+func (s *Set) markExecuted() {
+	if atomic.LoadUint32(&s.executed) == 0 {
+		s.mu.Lock()
+		s.init()
+		atomic.StoreUint32(&s.executed, 1)
+		s.mu.Unlock()
+	}
+}
+
+// ExecuteTo is like Execute, but the output is buffered and only written to
+// wr if the execution succeeds. If an error occurs, nothing is written to wr.
+func (s *Set) ExecuteTo(wr io.Writer, name string, data interface{}) error {
+	b := new(bytes.Buffer)
+	if err := s.Execute(b, name, data); err != nil {
+		return err
+	}
+	_, err := b.WriteTo(wr)
+	return err
+}
+
+// ExecuteString applies the template with the given name to the specified
+// data object and returns the output as a string.
+func (s *Set) ExecuteString(name string, data interface{}) (string, error) {
+	b := new(bytes.Buffer)
+	if err := s.Execute(b, name, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// MustExecute is like ExecuteString, but panics if an error occurs.
+// It is intended for use in tests and for templates known to be valid.
+func (s *Set) MustExecute(name string, data interface{}) string {
+	out, err := s.ExecuteString(name, data)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
 // Walk functions step through the major pieces of the template structure,
 // generating output as they go.
 func (s *state) walk(dot reflect.Value, n parse.Node) {
@@ -170,6 +216,10 @@ func (s *state) walk(dot reflect.Value, n parse.Node) {
 	case *parse.FillNode:
 		s.line = n.Line
 		s.walkFill(dot, n)
+	case *parse.BreakNode:
+		panic(rangeBreak)
+	case *parse.ContinueNode:
+		panic(rangeContinue)
 	default:
 		s.errorf("unknown node: %s", n)
 	}
@@ -225,12 +275,32 @@ func isTrue(val reflect.Value) (truth, ok bool) {
 	return truth, true
 }
 
+// rangeControl values are panicked by {{break}} and {{continue}} to unwind
+// the execution of the innermost range body. The parser guarantees that
+// they only appear in range bodies.
+type rangeControl int
+
+const (
+	rangeBreak rangeControl = iota
+	rangeContinue
+)
+
 func (s *state) walkRange(dot reflect.Value, r *parse.RangeNode) {
 	defer s.pop(s.mark())
 	val, _ := indirect(s.evalPipeline(dot, r.Pipe))
 	// mark top of stack before any variables in the body are pushed.
 	mark := s.mark()
-	oneIteration := func(index, elem reflect.Value) {
+	// oneIteration returns false if the loop must stop.
+	oneIteration := func(index, elem reflect.Value) (more bool) {
+		defer s.pop(mark)
+		defer func() {
+			if e := recover(); e != nil {
+				if e != rangeBreak && e != rangeContinue {
+					panic(e)
+				}
+				more = e == rangeContinue
+			}
+		}()
 		// Set top var (lexically the second if there are two) to the element.
 		if len(r.Pipe.Decl) > 0 {
 			s.setVar(1, elem)
@@ -240,7 +310,7 @@ func (s *state) walkRange(dot reflect.Value, r *parse.RangeNode) {
 			s.setVar(2, index)
 		}
 		s.walk(elem, r.List)
-		s.pop(mark)
+		return true
 	}
 	switch val.Kind() {
 	case reflect.Array, reflect.Slice:
@@ -248,7 +318,9 @@ func (s *state) walkRange(dot reflect.Value, r *parse.RangeNode) {
 			break
 		}
 		for i := 0; i < val.Len(); i++ {
-			oneIteration(reflect.ValueOf(i), val.Index(i))
+			if !oneIteration(reflect.ValueOf(i), val.Index(i)) {
+				break
+			}
 		}
 		return
 	case reflect.Map:
@@ -256,7 +328,9 @@ func (s *state) walkRange(dot reflect.Value, r *parse.RangeNode) {
 			break
 		}
 		for _, key := range sortKeys(val.MapKeys()) {
-			oneIteration(key, val.MapIndex(key))
+			if !oneIteration(key, val.MapIndex(key)) {
+				break
+			}
 		}
 		return
 	case reflect.Chan:
@@ -269,7 +343,10 @@ func (s *state) walkRange(dot reflect.Value, r *parse.RangeNode) {
 			if !ok {
 				break
 			}
-			oneIteration(reflect.ValueOf(i), elem)
+			if !oneIteration(reflect.ValueOf(i), elem) {
+				// The channel wasn't empty: skip the else branch.
+				return
+			}
 		}
 		if i == 0 {
 			break
@@ -296,11 +373,24 @@ func (s *state) walkTemplate(dot reflect.Value, t *parse.TemplateNode) {
 	newState.set = s.set
 	newState.fillers = nil
 	newState.filling = false
+	newState.depth++
+	newState.checkDepth()
 	// No dynamic scoping: template invocations inherit no variables.
 	newState.vars = []variable{{"$", dot}}
 	newState.walk(dot, tmpl.List)
 }
 
+// checkDepth stops the execution if templates are nested too deep.
+func (s *state) checkDepth() {
+	max := s.set.option.maxDepth
+	if max == 0 {
+		max = maxExecDepth
+	}
+	if s.depth > max {
+		s.errorf("exceeded maximum template depth (%d)", max)
+	}
+}
+
 // walkBlock walks a 'block' node.
 func (s *state) walkBlock(dot reflect.Value, b *parse.BlockNode) {
 	if s.filling {
@@ -331,6 +421,8 @@ func (s *state) walkFill(dot reflect.Value, f *parse.FillNode) {
 	newState.set = s.set
 	newState.fillers = nil
 	newState.filling = true
+	newState.depth++
+	newState.checkDepth()
 	newState.walk(dot, f.List)
 	newState.filling = false
 	// No dynamic scoping: template invocations inherit no variables.
@@ -453,9 +545,49 @@ func (s *state) evalFunction(dot reflect.Value, name string, args []parse.Node,
 	if !ok {
 		s.errorf("%q is not a defined function", name)
 	}
+	if _, custom := s.set.execFuncs[name]; name == "include" && !custom {
+		function = reflect.ValueOf(s.include)
+	}
 	return s.evalCall(dot, function, name, args, final)
 }
 
+// derivedNameMarker is found in the names of the templates derived by the
+// escaper for contexts other than HTML text; see context.mangle in the
+// escape package.
+const derivedNameMarker = "$htmltemplate_"
+
+// include implements the include builtin: it executes the template with
+// the given name, chosen at run time, using the optional data as dot.
+//
+// The output is typed as HTML: in escaped sets, the templates that can be
+// included are escaped for the HTML text context, so it is only left intact
+// in that context. The copies derived by the escaper for other contexts
+// can't be included.
+func (s *state) include(name string, data ...interface{}) (escape.HTML, error) {
+	if len(data) > 1 {
+		return "", fmt.Errorf("include: wrong number of args for %q: want at most 1 got %d", name, len(data))
+	}
+	tmpl := s.set.Tree[name]
+	if tmpl == nil || strings.Contains(name, derivedNameMarker) {
+		return "", fmt.Errorf("include: template %q not defined", name)
+	}
+	var dot reflect.Value
+	if len(data) == 1 {
+		dot = reflect.ValueOf(data[0])
+	}
+	b := new(bytes.Buffer)
+	newState := *s
+	newState.wr = b
+	newState.fillers = nil
+	newState.filling = false
+	newState.depth++
+	newState.checkDepth()
+	// No dynamic scoping: template invocations inherit no variables.
+	newState.vars = []variable{{"$", dot}}
+	newState.walk(dot, tmpl.List)
+	return escape.HTML(b.String()), nil
+}
+
 // evalField evaluates an expression like (.Field) or (.Field arg1 arg2).
 // The 'final' argument represents the return value from the preceding
 // value of the pipeline, if any.
@@ -502,7 +634,18 @@ func (s *state) evalField(dot reflect.Value, fieldName string, args []parse.Node
 			if hasArgs {
 				s.errorf("%s is not a method but has arguments", fieldName)
 			}
-			return receiver.MapIndex(nameVal)
+			result := receiver.MapIndex(nameVal)
+			if !result.IsValid() {
+				switch s.set.option.missingKey {
+				case mapInvalid:
+					// Just use the invalid value.
+				case mapZeroValue:
+					result = reflect.Zero(receiver.Type().Elem())
+				case mapError:
+					s.errorf("map has no entry for key %q", fieldName)
+				}
+			}
+			return result
 		}
 	}
 	s.errorf("can't evaluate field %s in type %s", fieldName, typ)
@@ -9,9 +9,11 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"reflect"
 	"strings"
 	"testing"
+	textTemplate "text/template"
 
 	"code.google.com/p/sadbox/template/escape"
 )
@@ -229,6 +231,11 @@ var execTests = []execTest{
 	{"text", "", "some text", "some text", nil, true},
 	{"nil action", "", "{{nil}}", "", nil, false},
 
+	// Comments.
+	{"comment", "", "a{{/* a comment */}}b", "ab", nil, true},
+	{"multi-line comment", "", "a{{/* a\ncomment {{.X}} */}}b", "ab", tVal, true},
+	{"comment with trim markers", "", "a {{- /* a comment */ -}} b", "ab", nil, true},
+
 	// Ideal constants.
 	{"ideal int", "", "{{typeOf 3}}", "int", 0, true},
 	{"ideal float", "", "{{typeOf 1.0}}", "float64", 0, true},
@@ -346,6 +353,8 @@ var execTests = []execTest{
 	{"if nil", "", "{{if nil}}TRUE{{end}}", "", tVal, false},
 	{"if 1", "", "{{if 1}}NON-ZERO{{else}}ZERO{{end}}", "NON-ZERO", tVal, true},
 	{"if 0", "", "{{if 0}}NON-ZERO{{else}}ZERO{{end}}", "ZERO", tVal, true},
+	{"if else if", "", "{{if 0}}ZERO{{else if 1}}ONE{{else}}NONE{{end}}", "ONE", tVal, true},
+	{"if else if else", "", "{{if 0}}ZERO{{else if ``}}EMPTY{{else}}NONE{{end}}", "NONE", tVal, true},
 	{"if 1.5", "", "{{if 1.5}}NON-ZERO{{else}}ZERO{{end}}", "NON-ZERO", tVal, true},
 	{"if 0.0", "", "{{if .FloatZero}}NON-ZERO{{else}}ZERO{{end}}", "ZERO", tVal, true},
 	{"if 1.5i", "", "{{if 1.5i}}NON-ZERO{{else}}ZERO{{end}}", "NON-ZERO", tVal, true},
@@ -370,6 +379,8 @@ var execTests = []execTest{
 	{"printf float", "", `{{printf "%g" 3.5}}`, "3.5", tVal, true},
 	{"printf complex", "", `{{printf "%g" 1+7i}}`, "(1+7i)", tVal, true},
 	{"printf string", "", `{{printf "%s" "hello"}}`, "hello", tVal, true},
+	{"raw string", "", "{{print `C:\\dir\\\"x\"\n+`}}", "C:\\dir\\\"x\"\n+", tVal, true},
+	{"raw string regexp", "", "{{printf `%q` `^\\d+\\.\\d*$`}}", `"^\\d+\\.\\d*$"`, tVal, true},
 	{"printf function", "", `{{printf "%#q" zeroArgs}}`, "`zeroArgs`", tVal, true},
 	{"printf field", "", `{{printf "%s" .U.V}}`, "v", tVal, true},
 	{"printf method", "", `{{printf "%s" .Method0}}`, "M0", tVal, true},
@@ -439,6 +450,10 @@ var execTests = []execTest{
 	{"range empty no else", "", "{{range .SIEmpty}}-{{.}}-{{end}}", "", tVal, true},
 	{"range []int else", "", "{{range .SI}}-{{.}}-{{else}}EMPTY{{end}}", "-3--4--5-", tVal, true},
 	{"range empty else", "", "{{range .SIEmpty}}-{{.}}-{{else}}EMPTY{{end}}", "EMPTY", tVal, true},
+	{"range break", "", "{{range $i, $x := .SI}}{{if $i}}{{break}}{{end}}-{{$x}}-{{end}}", "-3-", tVal, true},
+	{"range continue", "", "{{range $i, $x := .SI}}{{if $i}}{{continue}}{{end}}-{{$x}}-{{end}}", "-3-", tVal, true},
+	{"range map break", "", "{{range .MSI}}{{break}}{{end}}done", "done", tVal, true},
+	{"range nested break", "", "{{range .SI}}[{{range $i, $x := $.SI}}{{if $i}}{{break}}{{end}}{{$x}}{{end}}]{{end}}", "[3][3][3]", tVal, true},
 	{"range []bool", "", "{{range .SB}}-{{.}}-{{end}}", "-true--false-", tVal, true},
 	{"range []int method", "", "{{range .SI | .MAdd .I}}-{{.}}-{{end}}", "-20--21--22-", tVal, true},
 	{"range map", "", "{{range .MSI}}-{{.}}-{{end}}", "-1--3--2-", tVal, true},
@@ -542,6 +557,10 @@ func testExecute(execTests []execTest, template *Set, t *testing.T, wrap bool) {
 		"zeroArgs": zeroArgs,
 		"stringer": stringer,
 	}
+	if template != nil {
+		// Funcs can't be called once the set was executed.
+		template.Funcs(funcs)
+	}
 	for _, test := range execTests {
 		var tmpl *Set
 		var err error
@@ -552,7 +571,7 @@ func testExecute(execTests []execTest, template *Set, t *testing.T, wrap bool) {
 		if template == nil {
 			tmpl, err = new(Set).Funcs(funcs).parse(input, test.title)
 		} else {
-			tmpl, err = template.Funcs(funcs).parse(input, test.title)
+			tmpl, err = template.parse(input, test.title)
 		}
 		if err != nil {
 			t.Errorf("%s: parse error: %s", test.title, err)
@@ -592,7 +611,6 @@ var delimPairs = []string{
 	"", "", // default
 	"{{", "}}", // same as default
 	"<<", ">>", // distinct
-	"|", "|", // same
 	"(日)", "(本)", // peculiar
 }
 
@@ -636,6 +654,65 @@ func TestDelims(t *testing.T) {
 	}
 }
 
+func TestBadDelims(t *testing.T) {
+	tests := []struct {
+		left, right string
+	}{
+		{"<<", "<<"},
+		{"|", "|"},
+		{"}}", ""},
+		{"", "{{"},
+		{"  ", ">>"},
+		{"<<", "\t"},
+		{"<", "<<"},
+		{"%>", ">"},
+	}
+	for _, test := range tests {
+		set := new(Set).Delims(test.left, test.right)
+		if _, err := set.Parse(`{{define "t"}}x{{end}}`); err == nil {
+			t.Errorf("delims %q %q: expected error", test.left, test.right)
+		} else if !strings.Contains(err.Error(), "delimiters") {
+			t.Errorf("delims %q %q: unexpected error %q", test.left, test.right, err)
+		}
+	}
+	// Fixing the delimiters clears the error.
+	set := new(Set).Delims("<<", "<<").Delims("<<", ">>")
+	if _, err := set.Parse(`<<define "t">>x<<end>>`); err != nil {
+		t.Errorf("unexpected error %q", err)
+	}
+}
+
+func TestTrimMarkers(t *testing.T) {
+	tests := []string{
+		"a \n\t {{- .X -}} \n b",
+		"a {{- .X}} b",
+		"a {{.X -}} b",
+		"a\n{{- /* comment */ -}}\nb",
+		"{{range .SI -}}\n  {{.}}\n{{- end}}",
+		"{{-3}} {{- 3 -}} {{- -3}}",
+	}
+	for _, text := range tests {
+		expected := new(bytes.Buffer)
+		tmpl := textTemplate.Must(textTemplate.New("t").Parse(text))
+		if err := tmpl.Execute(expected, tVal); err != nil {
+			t.Fatalf("%q: text/template exec err %s", text, err)
+		}
+		set, err := new(Set).Parse(`{{define "t"}}` + text + `{{end}}`)
+		if err != nil {
+			t.Errorf("%q: parse err %s", text, err)
+			continue
+		}
+		b := new(bytes.Buffer)
+		if err = set.Execute(b, "t", tVal); err != nil {
+			t.Errorf("%q: exec err %s", text, err)
+			continue
+		}
+		if b.String() != expected.String() {
+			t.Errorf("%q: expected %q got %q", text, expected.String(), b.String())
+		}
+	}
+}
+
 // Check that an error from a method flows back to the top.
 func TestExecuteError(t *testing.T) {
 	b := new(bytes.Buffer)
@@ -654,6 +731,236 @@ func TestExecuteError(t *testing.T) {
 	}
 }
 
+func TestExecuteTo(t *testing.T) {
+	funcs := FuncMap{
+		"fail": func() string {
+			panic(errors.New("fail called"))
+		},
+	}
+	set, err := new(Set).Funcs(funcs).Parse(`{{define "ok"}}a{{.}}b{{end}}{{define "fail"}}a{{.}}{{fail}}b{{end}}`)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	b := new(bytes.Buffer)
+	if err = set.ExecuteTo(b, "ok", "x"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b.String() != "axb" {
+		t.Errorf("expected %q got %q", "axb", b.String())
+	}
+	b.Reset()
+	err = set.ExecuteTo(b, "fail", "x")
+	if err == nil || !strings.Contains(err.Error(), "fail called") {
+		t.Errorf("expected error from fail; got %v", err)
+	}
+	if b.Len() != 0 {
+		t.Errorf("expected no output; got %q", b.String())
+	}
+	// Execute writes the partial output.
+	if err = set.Execute(b, "fail", "x"); err == nil {
+		t.Errorf("expected error from fail; got none")
+	}
+	if b.String() != "ax" {
+		t.Errorf("expected %q got %q", "ax", b.String())
+	}
+}
+
+func TestFuncsAfterExecute(t *testing.T) {
+	set, err := new(Set).Funcs(FuncMap{"upper": strings.ToUpper}).Parse(`{{define "t"}}{{upper .}}{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Funcs either happens before the first execution or fails; it
+	// never races with execution (run with -race).
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			if got := set.MustExecute("t", "x"); got != "X" {
+				t.Errorf("expected %q got %q", "X", got)
+			}
+		}
+		done <- true
+	}()
+	for i := 0; i < 100; i++ {
+		set.Funcs(FuncMap{"lower": strings.ToLower})
+	}
+	<-done
+	const want = "template: Funcs called after the set was executed"
+	if err := set.Funcs(FuncMap{"lower": strings.ToLower}).Err(); err == nil || err.Error() != want {
+		t.Errorf("expected error %q from Funcs, got %v", want, err)
+	}
+	// The set keeps working.
+	if got, err := set.ExecuteString("t", "x"); err != nil || got != "X" {
+		t.Errorf("expected %q got %q, %v", "X", got, err)
+	}
+	if _, err := set.Escape(); err == nil {
+		t.Errorf("expected error escaping after execution")
+	}
+	// A clone can be extended.
+	clone, err := set.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := clone.Funcs(FuncMap{"lower": strings.ToLower}).Err(); err != nil {
+		t.Fatal(err)
+	}
+	clone, err = clone.Parse(`{{define "u"}}{{lower .}}{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := clone.ExecuteString("u", "X"); err != nil || out != "x" {
+		t.Errorf("clone: expected %q got %q, %v", "x", out, err)
+	}
+}
+
+func TestElseIf(t *testing.T) {
+	set, err := new(Set).Funcs(FuncMap{
+		"eq":  func(n int) bool { return n == 0 },
+		"one": func(n int) bool { return n == 1 },
+		"two": func(n int) bool { return n == 2 },
+	}).Parse(`
+		{{define "chain"}}{{if eq .}}zero{{else if one .}}one{{else if two .}}two{{else}}many{{end}}{{end}}
+		{{define "nested"}}{{if eq .}}zero{{else}}{{if one .}}one{{else}}{{if two .}}two{{else}}many{{end}}{{end}}{{end}}{{end}}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < 4; n++ {
+		chain, err := set.ExecuteString("chain", n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nested, err := set.ExecuteString("nested", n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chain != nested {
+			t.Errorf("%d: expected %q got %q", n, nested, chain)
+		}
+	}
+}
+
+func TestInclude(t *testing.T) {
+	set, err := Parse(`
+		{{define "page"}}<div>{{include .Partial .}}</div>{{end}}
+		{{define "card"}}<p class="card">{{.Title}}</p>{{end}}
+		{{define "list"}}<ul><li>{{.Title}}</li></ul>{{end}}
+		{{define "name"}}{{include "card"}}{{end}}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type page struct {
+		Partial, Title string
+	}
+	tests := []struct {
+		data page
+		want string
+	}{
+		{page{"card", "<Hello>"}, `<div><p class="card"><Hello></p></div>`},
+		{page{"list", "<Hello>"}, `<div><ul><li><Hello></li></ul></div>`},
+	}
+	for _, test := range tests {
+		got, err := set.ExecuteString("page", test.data)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.data.Partial, err)
+		} else if got != test.want {
+			t.Errorf("%s: expected %q got %q", test.data.Partial, test.want, got)
+		}
+	}
+	_, err = set.ExecuteString("page", page{"missing", ""})
+	if err == nil || !strings.Contains(err.Error(), `template "missing" not defined`) {
+		t.Errorf("expected error for a missing template, got %v", err)
+	}
+	// Dot is optional.
+	got, err := set.ExecuteString("name", nil)
+	if err != nil || !strings.HasPrefix(got, `<p class="card">`) {
+		t.Errorf("expected output without data, got %q (%v)", got, err)
+	}
+
+	// In escaped sets, partials are escaped and not escaped again.
+	set, err = set.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = set.Escape(); err != nil {
+		t.Fatal(err)
+	}
+	got, err = set.ExecuteString("page", page{"card", "<Hello>"})
+	if want := `<div><p class="card">&lt;Hello&gt;</p></div>`; err != nil || got != want {
+		t.Errorf("escaped: expected %q got %q (%v)", want, got, err)
+	}
+
+	// Templates derived by the escaper for other contexts can't be
+	// included: their output is not safe in HTML text.
+	set, err = Parse(`
+		{{define "page"}}<div>{{include .Partial .}}</div>{{end}}
+		{{define "card"}}<p class="card">{{.Title}}</p>{{end}}
+		{{define "attr"}}<a title="{{template "title" .}}">x</a>{{end}}
+		{{define "title"}}{{.Title}}{{end}}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = set.Escape(); err != nil {
+		t.Fatal(err)
+	}
+	var derived []string
+	for name := range set.Tree {
+		if strings.Contains(name, "$") {
+			derived = append(derived, name)
+		}
+	}
+	if len(derived) == 0 {
+		t.Fatal("expected templates derived by the escaper")
+	}
+	for _, name := range derived {
+		_, err = set.ExecuteString("page", page{name, "<Hello>"})
+		if err == nil || !strings.Contains(err.Error(), "not defined") {
+			t.Errorf("%s: expected error for a derived template, got %v", name, err)
+		}
+	}
+}
+
+func TestExecuteString(t *testing.T) {
+	set := Must(new(Set).Parse(`{{define "hello"}}Hello, {{.}}!{{end}}`))
+	out, err := set.ExecuteString("hello", "world")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out != "Hello, world!" {
+		t.Errorf("expected %q got %q", "Hello, world!", out)
+	}
+	if out, err = set.ExecuteString("missing", nil); err == nil {
+		t.Errorf("expected error for missing template; got output %q", out)
+	}
+	if out = set.MustExecute("hello", "you"); out != "Hello, you!" {
+		t.Errorf("expected %q got %q", "Hello, you!", out)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic from MustExecute")
+		}
+	}()
+	set.MustExecute("missing", nil)
+}
+
+func TestMaxExecDepth(t *testing.T) {
+	text := `{{define "ping"}}{{template "pong" .}}{{end}}{{define "pong"}}{{template "ping" .}}{{end}}`
+	set := Must(new(Set).Option("maxdepth=10").Parse(text))
+	err := set.Execute(ioutil.Discard, "ping", nil)
+	expected := "exceeded maximum template depth (10)"
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected error %q; got %v", expected, err)
+	}
+	set = Must(new(Set).Parse(text))
+	err = set.Execute(ioutil.Discard, "ping", nil)
+	expected = "exceeded maximum template depth (100000)"
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected error %q; got %v", expected, err)
+	}
+}
+
 func TestJSEscaping(t *testing.T) {
 	testCases := []struct {
 		in, exp string
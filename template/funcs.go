@@ -22,6 +22,7 @@ var builtins = FuncMap{
 	"and":      and,
 	"call":     call,
 	"html":     escape.HTMLEscaper,
+	"include":  include,
 	"index":    index,
 	"js":       escape.JSEscaper,
 	"len":      length,
@@ -89,6 +90,15 @@ func findFunction(name string, tmpl *Set) (reflect.Value, bool) {
 	return reflect.Value{}, false
 }
 
+// Including.
+
+// include executes the template with the given name and returns its output.
+// It is bound to the executing set by state.evalFunction; this placeholder
+// only declares the function for the parser.
+func include(name string, data ...interface{}) (escape.HTML, error) {
+	return "", fmt.Errorf("include: no set to execute %q", name)
+}
+
 // Indexing.
 
 // index returns the result of indexing its first argument by the following
@@ -0,0 +1,21 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package template
+
+import (
+	"code.google.com/p/sadbox/i18n"
+)
+
+// I18nFuncs returns a function map to translate messages in templates using
+// the given catalog. It provides the T, TN and TC functions described by
+// i18n.TemplateFuncs.
+//
+// Functions must be known at parse time, so the map must be added using
+// Set.Funcs before the templates are parsed:
+//
+//	set, err := new(template.Set).Funcs(template.I18nFuncs(c)).Parse(text)
+func I18nFuncs(c i18n.Catalog) FuncMap {
+	return FuncMap(i18n.TemplateFuncs(c))
+}
@@ -0,0 +1,48 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package template
+
+import (
+	"bytes"
+	"testing"
+
+	"code.google.com/p/sadbox/gettext"
+)
+
+func TestI18nFuncs(t *testing.T) {
+	c := gettext.NewCatalog()
+	c.Add(&gettext.SimpleMessage{Src: "Hello", Dst: "Olá"})
+	c.Add(&gettext.SimpleMessage{Src: "Hello, %s", Dst: "Olá, %s"})
+	c.Add(&gettext.PluralMessage{
+		Src: []string{"%d file", "%d files"},
+		Dst: []string{"%d arquivo", "%d arquivos"},
+	})
+	set, err := new(Set).Funcs(I18nFuncs(c)).Parse(`
+{{define "T"}}{{T "Hello"}}|{{T "Hello, %s" .Name}}|{{T "Bye"}}{{end}}
+{{define "TN"}}{{TN "%d file" "%d files" .Count .Count}}|{{TN "%d dir" "%d dirs" .Count .Count}}{{end}}
+`)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+	tests := []struct {
+		name   string
+		data   map[string]interface{}
+		output string
+	}{
+		{"T", map[string]interface{}{"Name": "Ana"}, "Olá|Olá, Ana|Bye"},
+		{"TN", map[string]interface{}{"Count": 1}, "1 arquivo|1 dir"},
+		{"TN", map[string]interface{}{"Count": 3}, "3 arquivos|3 dirs"},
+	}
+	for _, test := range tests {
+		b := new(bytes.Buffer)
+		if err := set.Execute(b, test.name, test.data); err != nil {
+			t.Errorf("%s: exec error: %s", test.name, err)
+			continue
+		}
+		if b.String() != test.output {
+			t.Errorf("%s: expected %q got %q", test.name, test.output, b.String())
+		}
+	}
+}
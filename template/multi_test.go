@@ -9,8 +9,14 @@ package template
 import (
 	"bytes"
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"testing/fstest"
+
+	"code.google.com/p/sadbox/template/parse"
 )
 
 const (
@@ -137,6 +143,24 @@ func TestParseFiles(t *testing.T) {
 	testExecute(multiExecTests, set, t, false)
 }
 
+func TestParseFilesErrors(t *testing.T) {
+	tests := []struct {
+		files []string
+		err   string
+	}{
+		{[]string{"testdata/file1.tmpl", "testdata/error.tmpl"}, "template: testdata/error.tmpl:3:"},
+		{[]string{"testdata/file1.tmpl", "testdata/dup.tmpl"}, `template: testdata/dup.tmpl:3: duplicated template name "x"`},
+	}
+	for _, test := range tests {
+		_, err := ParseFiles(test.files...)
+		if err == nil {
+			t.Errorf("%v: expected error; got none", test.files)
+		} else if !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("%v: expected error starting with %q got %q", test.files, test.err, err)
+		}
+	}
+}
+
 func TestParseGlob(t *testing.T) {
 	_, err := ParseGlob("DOES NOT EXIST")
 	if err == nil {
@@ -153,6 +177,106 @@ func TestParseGlob(t *testing.T) {
 	testExecute(multiExecTests, set, t, false)
 }
 
+func TestParseFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"testdata/file1.tmpl": {Data: []byte(`{{define "x"}}TEXT{{end}}
+{{define "dotV"}}{{.V}}{{end}}
+`)},
+		"testdata/file2.tmpl": {Data: []byte(`{{define "dot"}}{{.}}{{end}}
+{{define "nested"}}{{template "dot" .}}{{end}}
+`)},
+		"testdata/other.txt": {Data: []byte(`{{define "other"}}{{end}}`)},
+	}
+	_, err := ParseFS(fsys, "DOES NOT EXIST")
+	if err == nil {
+		t.Error("expected error for non-existent file; got none")
+	}
+	_, err = new(Set).ParseFS(fsys, "[x")
+	if err == nil {
+		t.Error("expected error for bad pattern; got none")
+	}
+	set, err := ParseFS(fsys, "testdata/file*.tmpl")
+	if err != nil {
+		t.Fatalf("error parsing files: %v", err)
+	}
+	if set.Lookup("other") {
+		t.Errorf("expected template %q not to be parsed", "other")
+	}
+	testExecute(multiExecTests, set, t, false)
+	// Errors carry the name of the file that failed.
+	fsys["testdata/bad.tmpl"] = &fstest.MapFile{Data: []byte(`{{define "bad"}}{{.X}`)}
+	_, err = ParseFS(fsys, "testdata/bad.tmpl")
+	if err == nil || !strings.Contains(err.Error(), "testdata/bad.tmpl") {
+		t.Errorf("expected error naming the file; got %v", err)
+	}
+}
+
+func TestParseGlobRecursive(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"file1.tmpl":         `{{define "x"}}TEXT{{end}}{{define "dotV"}}{{.V}}{{end}}`,
+		"a/file2.tmpl":       `{{define "dot"}}{{.}}{{end}}`,
+		"a/b/c/nested.tmpl":  `{{define "nested"}}{{template "dot" .}}{{end}}`,
+		"a/b/other.txt":      `{{define "other"}}{{end}}`,
+		"empty/dir/none.txt": ``,
+	}
+	for name, text := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	set, err := ParseGlobRecursive(root, ".tmpl")
+	if err != nil {
+		t.Fatalf("error parsing files: %v", err)
+	}
+	if set.Lookup("other") {
+		t.Errorf("expected template %q not to be parsed", "other")
+	}
+	testExecute(multiExecTests, set, t, false)
+	_, err = new(Set).ParseGlobRecursive(filepath.Join(root, "empty"), ".tmpl")
+	if err == nil {
+		t.Error("expected error for directory without templates; got none")
+	}
+	_, err = new(Set).ParseGlobRecursive(filepath.Join(root, "missing"), ".tmpl")
+	if err == nil {
+		t.Error("expected error for non-existent directory; got none")
+	}
+}
+
+func TestAddParseTree(t *testing.T) {
+	set := Must(new(Set).Parse(`{{define "hello"}}Hello, {{template "name" .}}!{{end}}`))
+	tree := parse.Tree{
+		"name": &parse.DefineNode{
+			NodeType: parse.NodeDefine,
+			Line:     1,
+			Name:     "name",
+			List: &parse.ListNode{
+				NodeType: parse.NodeList,
+				Nodes: []parse.Node{
+					&parse.TextNode{NodeType: parse.NodeText, Text: []byte("World")},
+				},
+			},
+		},
+	}
+	if err := set.AddParseTree("built", tree); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out := set.MustExecute("hello", nil); out != "Hello, World!" {
+		t.Errorf("expected %q got %q", "Hello, World!", out)
+	}
+	err := set.AddParseTree("built", tree)
+	if err == nil || !strings.Contains(err.Error(), `built:1: duplicated template name "name"`) {
+		t.Errorf("expected duplicated template error; got %v", err)
+	}
+	if err = set.AddParseTree("built", parse.Tree{"nil": nil}); err == nil {
+		t.Errorf("expected error for nil template; got none")
+	}
+}
+
 // In these tests, actual content (not just template definitions) comes from the parsed files.
 
 var templateFileExecTests = []execTest{
@@ -241,3 +365,172 @@ func TestRedefinition(t *testing.T) {
 		t.Fatalf("expected redefinition error; got %v", err)
 	}
 }
+
+func TestLookupTemplates(t *testing.T) {
+	set, err := new(Set).Parse(`{{define "foo"}}FOO{{end}}{{define "bar"}}BAR{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = set.Parse(`{{define "baz"}}BAZ{{end}}`); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"foo", "bar", "baz"} {
+		if !set.Lookup(name) {
+			t.Errorf("expected template %q to be defined", name)
+		}
+	}
+	if set.Lookup("qux") {
+		t.Errorf("unexpected template %q", "qux")
+	}
+	expected := []string{"bar", "baz", "foo"}
+	if names := set.Templates(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v got %v", expected, names)
+	}
+	if names := new(Set).Templates(); len(names) != 0 {
+		t.Errorf("expected no templates; got %v", names)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	set, err := new(Set).Parse(`{{define "foo"}}FOO{{end}}{{define "bar"}}BAR{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = set.Remove("foo"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if set.Lookup("foo") {
+		t.Errorf("expected template %q to be removed", "foo")
+	}
+	if err = set.Remove("foo"); err == nil {
+		t.Errorf("expected error removing undefined template")
+	}
+	// The name can be defined again.
+	if _, err = set.Parse(`{{define "foo"}}NEW FOO{{end}}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = set.Escape(); err != nil {
+		t.Fatal(err)
+	}
+	err = set.Remove("bar")
+	if err == nil || !strings.Contains(err.Error(), "after escaping") {
+		t.Errorf("expected error removing after escaping; got %v", err)
+	}
+	if !set.Lookup("bar") {
+		t.Errorf("expected template %q to be kept", "bar")
+	}
+}
+
+func TestMissingKey(t *testing.T) {
+	data := map[string]int{"x": 99}
+	tests := []struct {
+		option string
+		output string
+		ok     bool
+	}{
+		{"", "99 <no value>", true},
+		{"missingkey=default", "99 <no value>", true},
+		{"missingkey=invalid", "99 <no value>", true},
+		{"missingkey=zero", "99 0", true},
+		{"missingkey=error", "99 ", false},
+	}
+	for _, test := range tests {
+		set := new(Set)
+		if test.option != "" {
+			set.Option(test.option)
+		}
+		if _, err := set.Parse(`{{define "t"}}{{.x}} {{.y}}{{end}}`); err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		err := set.Execute(&b, "t", data)
+		switch {
+		case test.ok && err != nil:
+			t.Errorf("%q: unexpected error: %v", test.option, err)
+		case !test.ok && err == nil:
+			t.Errorf("%q: expected error; got none", test.option)
+		case !test.ok && !strings.Contains(err.Error(), `no entry for key "y"`):
+			t.Errorf("%q: unexpected error: %v", test.option, err)
+		}
+		if b.String() != test.output {
+			t.Errorf("%q: expected %q got %q", test.option, test.output, b.String())
+		}
+	}
+}
+
+func TestBadOption(t *testing.T) {
+	for _, opt := range []string{"", "missingkey", "missingkey=bad", "unknown=zero", "maxdepth=0", "maxdepth=x"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%q: expected panic", opt)
+				}
+			}()
+			new(Set).Option(opt)
+		}()
+	}
+}
+
+func TestWalk(t *testing.T) {
+	set, err := new(Set).Parse(benchTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	parse.Walk(set.Tree, func(n parse.Node) bool {
+		if n, ok := n.(*parse.TemplateNode); ok {
+			names = append(names, n.Name)
+		}
+		return true
+	})
+	expected := []string{"title", "header", "footer"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v got %v", expected, names)
+	}
+	// Returning false skips the children.
+	names = nil
+	parse.Walk(set.Tree, func(n parse.Node) bool {
+		if n, ok := n.(*parse.DefineNode); ok {
+			names = append(names, n.Name)
+			return false
+		}
+		t.Errorf("unexpected visit to %s", n)
+		return true
+	})
+	expected = []string{"footer", "header", "page", "title"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v got %v", expected, names)
+	}
+}
+
+func TestWalkPipes(t *testing.T) {
+	set, err := new(Set).Parse(benchTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pipes []string
+	parse.WalkPipes(set.Tree, func(p *parse.PipeNode) {
+		pipes = append(pipes, p.String())
+	})
+	expected := []string{
+		".PageTitle", // header
+		".", ".",     // page: title, header
+		".Menu", ".Link", ".Text", // page: menu
+		".Rows", ".", ".", // page: rows
+		".",          // page: footer
+		".PageTitle", // title
+	}
+	if !reflect.DeepEqual(pipes, expected) {
+		t.Errorf("expected %d pipelines %v got %d %v", len(expected), expected, len(pipes), pipes)
+	}
+	// Pipelines can be rewritten.
+	parse.WalkPipes(set.Tree, func(p *parse.PipeNode) {
+		p.Cmds = append(p.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Args:     []parse.Node{&parse.IdentifierNode{NodeType: parse.NodeIdentifier, Ident: "upper"}},
+		})
+	})
+	if s := set.Tree["title"].String(); s != `{{define "title"}}{{.PageTitle | upper}}{{end}}` {
+		t.Errorf("unexpected rewritten template: %s", s)
+	}
+}
@@ -66,6 +66,8 @@ const (
 	itemWith     // with keyword
 	itemBlock    // block keyword
 	itemFill     // fill keyword
+	itemBreak    // break keyword
+	itemContinue // continue keyword
 )
 
 // Make the types prettyprint.
@@ -98,6 +100,8 @@ var itemName = map[itemType]string{
 	itemWith:     "with",
 	itemBlock:    "block",
 	itemFill:     "fill",
+	itemBreak:    "break",
+	itemContinue: "continue",
 }
 
 func (i itemType) String() string {
@@ -120,6 +124,8 @@ var key = map[string]itemType{
 	"with":     itemWith,
 	"block":    itemBlock,
 	"fill":     itemFill,
+	"break":    itemBreak,
+	"continue": itemContinue,
 }
 
 const eof = -1
@@ -198,6 +204,13 @@ func (l *lexer) lineNumber() int {
 	return 1 + strings.Count(l.input[:l.lastPos], "\n")
 }
 
+// columnNumber reports the column of the previous item returned by
+// nextItem, counting runes from 1 at the start of its line.
+func (l *lexer) columnNumber() int {
+	lineStart := strings.LastIndex(l.input[:l.lastPos], "\n") + 1
+	return 1 + utf8.RuneCountInString(l.input[lineStart:l.lastPos])
+}
+
 // error returns an error token and terminates the scan by passing
 // back a nil pointer that will be the next state, terminating l.nextItem.
 func (l *lexer) errorf(format string, args ...interface{}) stateFn {
@@ -248,15 +261,28 @@ const (
 	rightDelim   = "}}"
 	leftComment  = "/*"
 	rightComment = "*/"
+	// Trim markers remove the white space adjacent to an action:
+	// "{{- " trims before the action and " -}}" trims after it.
+	leftTrimMarker  = "- "
+	rightTrimMarker = " -"
+	trimMarkerLen   = 2
+	spaceChars      = " \t\r\n"
 )
 
 // lexText scans until an opening action delimiter, "{{".
 func lexText(l *lexer) stateFn {
 	for {
 		if strings.HasPrefix(l.input[l.pos:], l.leftDelim) {
+			trimLength := 0
+			if strings.HasPrefix(l.input[l.pos+len(l.leftDelim):], leftTrimMarker) {
+				trimLength = rightTrimLength(l.input[l.start:l.pos])
+			}
+			l.pos -= trimLength
 			if l.pos > l.start {
 				l.emit(itemText)
 			}
+			l.pos += trimLength
+			l.ignore()
 			return lexLeftDelim
 		}
 		if l.next() == eof {
@@ -271,32 +297,86 @@ func lexText(l *lexer) stateFn {
 	return nil
 }
 
-// lexLeftDelim scans the left delimiter, which is known to be present.
+// rightTrimLength returns the length of the spaces at the end of the string.
+func rightTrimLength(s string) int {
+	return len(s) - len(strings.TrimRight(s, spaceChars))
+}
+
+// leftTrimLength returns the length of the spaces at the beginning of the
+// string.
+func leftTrimLength(s string) int {
+	return len(s) - len(strings.TrimLeft(s, spaceChars))
+}
+
+// atRightDelim reports whether the lexer is at a right delimiter, possibly
+// preceded by a trim marker.
+func (l *lexer) atRightDelim() (delim, trimSpaces bool) {
+	if strings.HasPrefix(l.input[l.pos:], l.rightDelim) {
+		return true, false
+	}
+	if strings.HasPrefix(l.input[l.pos:], rightTrimMarker) &&
+		strings.HasPrefix(l.input[l.pos+trimMarkerLen:], l.rightDelim) {
+		return true, true
+	}
+	return false, false
+}
+
+// lexLeftDelim scans the left delimiter, which is known to be present,
+// possibly followed by a trim marker.
 func lexLeftDelim(l *lexer) stateFn {
 	l.pos += len(l.leftDelim)
-	if strings.HasPrefix(l.input[l.pos:], leftComment) {
+	afterMarker := 0
+	if strings.HasPrefix(l.input[l.pos:], leftTrimMarker) {
+		afterMarker = trimMarkerLen
+	}
+	if strings.HasPrefix(l.input[l.pos+afterMarker:], leftComment) {
+		l.pos += afterMarker
+		l.ignore()
 		return lexComment
 	}
 	l.emit(itemLeftDelim)
+	l.pos += afterMarker
+	l.ignore()
 	return lexInsideAction
 }
 
 // lexComment scans a comment. The left comment marker is known to be present.
 func lexComment(l *lexer) stateFn {
 	l.pos += len(leftComment)
-	i := strings.Index(l.input[l.pos:], rightComment+l.rightDelim)
+	i := strings.Index(l.input[l.pos:], rightComment)
 	if i < 0 {
 		return l.errorf("unclosed comment")
 	}
-	l.pos += i + len(rightComment) + len(l.rightDelim)
+	l.pos += i + len(rightComment)
+	delim, trimSpace := l.atRightDelim()
+	if !delim {
+		return l.errorf("comment ends before closing delimiter")
+	}
+	if trimSpace {
+		l.pos += trimMarkerLen
+	}
+	l.pos += len(l.rightDelim)
+	if trimSpace {
+		l.pos += leftTrimLength(l.input[l.pos:])
+	}
 	l.ignore()
 	return lexText
 }
 
-// lexRightDelim scans the right delimiter, which is known to be present.
+// lexRightDelim scans the right delimiter, which is known to be present,
+// possibly preceded by a trim marker.
 func lexRightDelim(l *lexer) stateFn {
+	trimSpace := strings.HasPrefix(l.input[l.pos:], rightTrimMarker)
+	if trimSpace {
+		l.pos += trimMarkerLen
+		l.ignore()
+	}
 	l.pos += len(l.rightDelim)
 	l.emit(itemRightDelim)
+	if trimSpace {
+		l.pos += leftTrimLength(l.input[l.pos:])
+		l.ignore()
+	}
 	return lexText
 }
 
@@ -305,7 +385,7 @@ func lexInsideAction(l *lexer) stateFn {
 	// Either number, quoted string, or identifier.
 	// Spaces separate and are ignored.
 	// Pipe symbols separate and are emitted.
-	if strings.HasPrefix(l.input[l.pos:], l.rightDelim) {
+	if delim, _ := l.atRightDelim(); delim {
 		return lexRightDelim
 	}
 	switch r := l.next(); {
@@ -494,12 +574,13 @@ Loop:
 	return lexInsideAction
 }
 
-// lexRawQuote scans a raw quoted string.
+// lexRawQuote scans a raw quoted string. Like in Go, it can span lines and
+// backslashes have no special meaning.
 func lexRawQuote(l *lexer) stateFn {
 Loop:
 	for {
 		switch l.next() {
-		case eof, '\n':
+		case eof:
 			return l.errorf("unterminated raw quoted string")
 		case '`':
 			break Loop
@@ -47,6 +47,12 @@ var lexTests = []lexTest{
 	{"for", `{{for }}`, []item{tLeft, tFor, tRight, tEOF}},
 	{"quote", `{{"abc \n\t\" "}}`, []item{tLeft, tQuote, tRight, tEOF}},
 	{"raw quote", "{{" + raw + "}}", []item{tLeft, tRawQuote, tRight, tEOF}},
+	{"raw quote with newline", "{{`a\n\\\"}}b`}}", []item{
+		tLeft,
+		{itemRawString, 0, "`a\n\\\"}}b`"},
+		tRight,
+		tEOF,
+	}},
 	{"numbers", "{{1 02 0x14 -7.2i 1e3 +1.2e-4 4.2i 1+2i}}", []item{
 		tLeft,
 		{itemNumber, 0, "1"},
@@ -60,6 +66,17 @@ var lexTests = []lexTest{
 		tRight,
 		tEOF,
 	}},
+	{"decimal points", "{{.5 0.5 5. -.5 .5e3 .5i}}", []item{
+		tLeft,
+		{itemNumber, 0, ".5"},
+		{itemNumber, 0, "0.5"},
+		{itemNumber, 0, "5."},
+		{itemNumber, 0, "-.5"},
+		{itemNumber, 0, ".5e3"},
+		{itemNumber, 0, ".5i"},
+		tRight,
+		tEOF,
+	}},
 	{"characters", `{{'a' '\n' '\'' '\\' '\u00FF' '\xFF' '本'}}`, []item{
 		tLeft,
 		{itemCharConstant, 0, `'a'`},
@@ -177,7 +194,7 @@ var lexTests = []lexTest{
 		tLeft,
 		{itemError, 0, "unterminated quoted string"},
 	}},
-	{"unclosed raw quote", "{{`xx\n`}}", []item{
+	{"unclosed raw quote", "{{`xx}}", []item{
 		tLeft,
 		{itemError, 0, "unterminated raw quoted string"},
 	}},
@@ -207,6 +224,27 @@ var lexTests = []lexTest{
 		{itemText, 0, "hello-"},
 		{itemError, 0, `unclosed comment`},
 	}},
+	{"trimming spaces before and after", "hello- {{- 3 -}} -world", []item{
+		{itemText, 0, "hello-"},
+		tLeft,
+		{itemNumber, 0, "3"},
+		tRight,
+		{itemText, 0, "-world"},
+		tEOF,
+	}},
+	{"trimming spaces before and after comment", "hello- {{- /* hello */ -}} -world", []item{
+		{itemText, 0, "hello-"},
+		{itemText, 0, "-world"},
+		tEOF,
+	}},
+	{"negative number is not a trim marker", "hello {{-3}} world", []item{
+		{itemText, 0, "hello "},
+		tLeft,
+		{itemNumber, 0, "-3"},
+		tRight,
+		{itemText, 0, " world"},
+		tEOF,
+	}},
 }
 
 // collect gathers the emitted items into a slice.
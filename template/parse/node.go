@@ -37,7 +37,9 @@ const (
 	NodeAction                     // A simple action such as field evaluation.
 	NodeBlock                      // A block action.
 	NodeBool                       // A boolean constant.
+	NodeBreak                      // A break action.
 	NodeCommand                    // An element of a pipeline.
+	NodeContinue                   // A continue action.
 	NodeDefine                     // A template definition.
 	NodeDot                        // The cursor, dot.
 	nodeElse                       // An else action. Not added to tree.
@@ -521,6 +523,42 @@ func (e *endNode) Copy() Node {
 	return newEnd()
 }
 
+// BreakNode represents a {{break}} action.
+type BreakNode struct {
+	NodeType
+	Line int // The line number in the input.
+}
+
+func newBreak(line int) *BreakNode {
+	return &BreakNode{NodeType: NodeBreak, Line: line}
+}
+
+func (b *BreakNode) String() string {
+	return "{{break}}"
+}
+
+func (b *BreakNode) Copy() Node {
+	return newBreak(b.Line)
+}
+
+// ContinueNode represents a {{continue}} action.
+type ContinueNode struct {
+	NodeType
+	Line int // The line number in the input.
+}
+
+func newContinue(line int) *ContinueNode {
+	return &ContinueNode{NodeType: NodeContinue, Line: line}
+}
+
+func (c *ContinueNode) String() string {
+	return "{{continue}}"
+}
+
+func (c *ContinueNode) Copy() Node {
+	return newContinue(c.Line)
+}
+
 // elseNode represents an {{else}} action. Does not appear in the final tree.
 type elseNode struct {
 	NodeType
@@ -690,7 +728,7 @@ func (f *FillNode) validate(n *ListNode) {
 
 func (f *FillNode) isValid(n Node) bool {
 	switch n := n.(type) {
-	case *BlockNode:
+	case *BlockNode, *BreakNode, *ContinueNode:
 	case *ListNode:
 		f.validate(n)
 	case *IfNode:
@@ -713,9 +751,10 @@ func (f *FillNode) isValid(n Node) bool {
 // DefineNode represents a {{define}} action.
 type DefineNode struct {
 	NodeType
-	Line int       // The line number in the input.
-	Name string    // The name of the template (unquoted).
-	List *ListNode // Contents of the template.
+	Line      int       // The line number in the input.
+	Name      string    // The name of the template (unquoted).
+	List      *ListNode // Contents of the template.
+	ParseName string    // The name of the parsed input, e.g. a file name.
 }
 
 func newDefine(line int, name string, list *ListNode) *DefineNode {
@@ -727,7 +766,9 @@ func (d *DefineNode) String() string {
 }
 
 func (d *DefineNode) CopyDefine() *DefineNode {
-	return newDefine(d.Line, d.Name, d.List.CopyList())
+	n := newDefine(d.Line, d.Name, d.List.CopyList())
+	n.ParseName = d.ParseName
+	return n
 }
 
 func (d *DefineNode) Copy() Node {
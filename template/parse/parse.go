@@ -27,13 +27,14 @@ func Parse(text, name, leftDelim, rightDelim string, funcs ...map[string]interfa
 }
 
 type parser struct {
-	name      string // used for debugging only.
-	tree      Tree
-	funcs     []map[string]interface{}
-	lex       *lexer
-	token     [2]item // two-token lookahead for parser.
-	peekCount int
-	vars      []string // variables defined at the moment.
+	name       string // used for debugging only.
+	tree       Tree
+	funcs      []map[string]interface{}
+	lex        *lexer
+	token      [2]item // two-token lookahead for parser.
+	peekCount  int
+	vars       []string // variables defined at the moment.
+	rangeDepth int      // nesting level of the range bodies being parsed.
 }
 
 // next returns the next token.
@@ -69,9 +70,11 @@ func (p *parser) peek() item {
 
 // Parsing.
 
-// errorf formats the error and terminates processing.
+// errorf formats the error and terminates processing. The error is prefixed
+// with the name, line and column of the last token read.
 func (p *parser) errorf(format string, args ...interface{}) {
-	format = fmt.Sprintf("template: %s:%d: %s", p.name, p.lex.lineNumber(), format)
+	format = fmt.Sprintf("template: %s:%d:%d: %s", p.name, p.lex.lineNumber(),
+		p.lex.columnNumber(), format)
 	panic(fmt.Errorf(format, args...))
 }
 
@@ -170,7 +173,9 @@ func (p *parser) parseDefinition() *DefineNode {
 	if end.Type() != nodeEnd {
 		p.errorf("unexpected %s in %s", end, context)
 	}
-	return newDefine(line, name, list)
+	d := newDefine(line, name, list)
+	d.ParseName = p.name
+	return d
 }
 
 // itemList:
@@ -211,6 +216,10 @@ func (p *parser) textOrAction() Node {
 // First word could be a keyword such as range.
 func (p *parser) action() (n Node) {
 	switch token := p.next(); token.typ {
+	case itemBreak:
+		return p.breakControl()
+	case itemContinue:
+		return p.continueControl()
 	case itemElse:
 		return p.elseControl()
 	case itemEnd:
@@ -285,11 +294,30 @@ func (p *parser) parseControl(context string) (lineNum int, pipe *PipeNode, list
 	lineNum = p.lex.lineNumber()
 	defer p.popVars(len(p.vars))
 	pipe = p.pipeline(context)
+	if context == "range" {
+		p.rangeDepth++
+	}
 	var next Node
 	list, next = p.itemList()
+	if context == "range" {
+		p.rangeDepth--
+	}
 	switch next.Type() {
 	case nodeEnd: //done
 	case nodeElse:
+		// Special case for "else if": elseControl leaves the "if" token
+		// pending, and
+		//	{{if a}}_{{else if b}}_{{end}}
+		// is parsed as
+		//	{{if a}}_{{else}}{{if b}}_{{end}}{{end}}
+		// The nested if consumes the only {{end}}. This works for long
+		// if-else-if chains too.
+		if context == "if" && p.peek().typ == itemIf {
+			p.next() // Consume the "if" token.
+			elseList = newList()
+			elseList.append(p.ifControl())
+			break
+		}
 		elseList, next = p.itemList()
 		if next.Type() != nodeEnd {
 			p.errorf("expected end; found %s", next)
@@ -302,6 +330,7 @@ func (p *parser) parseControl(context string) (lineNum int, pipe *PipeNode, list
 // If:
 //	{{if pipeline}} itemList {{end}}
 //	{{if pipeline}} itemList {{else}} itemList {{end}}
+//	{{if pipeline}} itemList {{else if pipeline}} itemList {{end}}
 // If keyword is past.
 func (p *parser) ifControl() Node {
 	return newIf(p.parseControl("if"))
@@ -331,10 +360,36 @@ func (p *parser) endControl() Node {
 	return newEnd()
 }
 
+// Break:
+//	{{break}}
+// Break keyword is past.
+func (p *parser) breakControl() Node {
+	if p.rangeDepth == 0 {
+		p.errorf("{{break}} outside {{range}}")
+	}
+	p.expect(itemRightDelim, "break")
+	return newBreak(p.lex.lineNumber())
+}
+
+// Continue:
+//	{{continue}}
+// Continue keyword is past.
+func (p *parser) continueControl() Node {
+	if p.rangeDepth == 0 {
+		p.errorf("{{continue}} outside {{range}}")
+	}
+	p.expect(itemRightDelim, "continue")
+	return newContinue(p.lex.lineNumber())
+}
+
 // Else:
 //	{{else}}
 // Else keyword is past.
 func (p *parser) elseControl() Node {
+	// Special case for "else if"; parseControl handles the "if".
+	if p.peek().typ == itemIf {
+		return newElse(p.lex.lineNumber())
+	}
 	p.expect(itemRightDelim, "else")
 	return newElse(p.lex.lineNumber())
 }
@@ -392,7 +447,12 @@ func (p *parser) blockOrFill(context string) (lineNum int, name string, pipe *Pi
 		p.backup()
 		pipe = p.pipeline(context)
 	}
+	// The content may be executed elsewhere, as a filler or a filled
+	// block, so it can't leave an enclosing range.
+	rangeDepth := p.rangeDepth
+	p.rangeDepth = 0
 	list, end := p.itemList()
+	p.rangeDepth = rangeDepth
 	if end.Type() != nodeEnd {
 		p.errorf("expected <end> in %s", context)
 	}
@@ -7,6 +7,7 @@ package parse
 import (
 	"flag"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -37,6 +38,9 @@ var numberTests = []numberTest{
 	{"1e9", true, true, true, false, 1e9, 1e9, 1e9, 0},
 	{"-1e9", true, false, true, false, -1e9, 0, -1e9, 0},
 	{"-1.2", false, false, true, false, 0, 0, -1.2, 0},
+	{".5", false, false, true, false, 0, 0, .5, 0},
+	{"-.5", false, false, true, false, 0, 0, -.5, 0},
+	{"5.", true, true, true, false, 5, 5, 5, 0},
 	{"1e19", false, true, true, false, 0, 1e19, 1e19, 0},
 	{"-1e19", false, false, true, false, 0, 0, -1e19, 0},
 	{"4i", false, false, false, true, 0, 0, 0, 4i},
@@ -189,12 +193,28 @@ var parseTests = []parseTest{
 		`{{if .X}}"hello"{{end}}`},
 	{"if with else", "{{if .X}}true{{else}}false{{end}}", noError,
 		`{{if .X}}"true"{{else}}"false"{{end}}`},
+	{"if with else if", "{{if .X}}true{{else if .Y}}false{{end}}", noError,
+		`{{if .X}}"true"{{else}}{{if .Y}}"false"{{end}}{{end}}`},
+	{"if else chain", "+{{if .X}}X{{else if .Y}}Y{{else if .Z}}Z{{end}}+", noError,
+		`"+"{{if .X}}"X"{{else}}{{if .Y}}"Y"{{else}}{{if .Z}}"Z"{{end}}{{end}}{{end}}"+"`},
+	{"if else if with else", "{{if .X}}X{{else if .Y}}Y{{else}}Z{{end}}", noError,
+		`{{if .X}}"X"{{else}}{{if .Y}}"Y"{{else}}"Z"{{end}}{{end}}`},
+	{"else if without if", "{{range .X}}X{{else if .Y}}Y{{end}}", hasError, ""},
+	{"else if extra end", "{{if .X}}X{{else if .Y}}Y{{end}}{{end}}", hasError, ""},
 	{"simple range", "{{range .X}}hello{{end}}", noError,
 		`{{range .X}}"hello"{{end}}`},
 	{"chained field range", "{{range .X.Y.Z}}hello{{end}}", noError,
 		`{{range .X.Y.Z}}"hello"{{end}}`},
 	{"nested range", "{{range .X}}hello{{range .Y}}goodbye{{end}}{{end}}", noError,
 		`{{range .X}}"hello"{{range .Y}}"goodbye"{{end}}{{end}}`},
+	{"range with break", "{{range .X}}{{if .Y}}{{break}}{{end}}hello{{end}}", noError,
+		`{{range .X}}{{if .Y}}{{break}}{{end}}"hello"{{end}}`},
+	{"range with continue", "{{range .X}}{{continue}}{{end}}", noError,
+		`{{range .X}}{{continue}}{{end}}`},
+	{"break outside range", "{{break}}", hasError, ""},
+	{"continue outside range", "{{if .X}}{{continue}}{{end}}", hasError, ""},
+	{"break in range else", "{{range .X}}X{{else}}{{break}}{{end}}", hasError, ""},
+	{"break with args", "{{range .X}}{{break .Y}}{{end}}", hasError, ""},
 	{"range with else", "{{range .X}}true{{else}}false{{end}}", noError,
 		`{{range .X}}"true"{{else}}"false"{{end}}`},
 	{"range over pipeline", "{{range .X|.M}}true{{else}}false{{end}}", noError,
@@ -290,3 +310,58 @@ func TestParse(t *testing.T) {
 func TestParseCopy(t *testing.T) {
 	testParse(true, t)
 }
+
+func TestCopyTree(t *testing.T) {
+	tree, err := Parse(`{{define "a"}}a{{end}}{{define "b"}}b{{.X}}{{end}}`, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := map[string]string{}
+	for name, node := range tree {
+		orig[name] = node.String()
+	}
+	cp := tree.CopyTree()
+	if len(cp) != len(tree) {
+		t.Fatalf("expected %d templates in copy; got %d", len(tree), len(cp))
+	}
+	for name, node := range tree {
+		if cp[name] == node {
+			t.Errorf("%q: copy shares the define node with the original", name)
+		}
+		if cp[name].String() != node.String() {
+			t.Errorf("%q: got\n\t%v\nexpected\n\t%v", name, cp[name], node)
+		}
+	}
+	// Modifying the copy must not change the original.
+	cp["a"].List.Nodes[0].(*TextNode).Text[0] = 'x'
+	cp["b"].List.Nodes = nil
+	delete(cp, "a")
+	for name, node := range tree {
+		if node.String() != orig[name] {
+			t.Errorf("%q: original changed: got\n\t%v\nexpected\n\t%v", name, node, orig[name])
+		}
+	}
+	if len(tree) != len(orig) {
+		t.Errorf("expected %d templates in original; got %d", len(orig), len(tree))
+	}
+}
+
+func TestErrorPosition(t *testing.T) {
+	tests := []struct {
+		text string
+		pos  string
+	}{
+		{"{{define \"a\"}}\nab {{nofunc}}{{end}}", "test:2:6: "},
+		{"{{define \"a\"}}h\u00e9llo {{nofunc}}{{end}}", "test:1:23: "},
+		{"{{define \"a\"}}{{if .X}}\n  x {{else}} {{$x}}{{end}}{{end}}", "test:2:18: "},
+		{"{{define \"a\"}}\n\n{{range .X}}{{break 1}}{{end}}{{end}}", "test:3:21: "},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.text, "test", "", "")
+		if err == nil {
+			t.Errorf("%q: expected error", test.text)
+		} else if !strings.HasPrefix(err.Error(), "template: "+test.pos) {
+			t.Errorf("%q: expected position %q in error, got %q", test.text, test.pos, err)
+		}
+	}
+}
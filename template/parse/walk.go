@@ -0,0 +1,94 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package parse
+
+import (
+	"sort"
+)
+
+// Walk traverses the templates in the tree in pre-order, calling fn for each
+// DefineNode and for every node in its contents. Templates are visited in
+// name order.
+//
+// Walk descends into the lists of ListNode, IfNode, RangeNode, WithNode,
+// BlockNode and FillNode. If fn returns false, the children of that node
+// are not visited.
+func Walk(tree Tree, fn func(Node) bool) {
+	names := make([]string, 0, len(tree))
+	for name, _ := range tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		walk(tree[name], fn)
+	}
+}
+
+// walk visits a node and its children.
+func walk(node Node, fn func(Node) bool) {
+	if !fn(node) {
+		return
+	}
+	switch n := node.(type) {
+	case *DefineNode:
+		walkList(n.List, fn)
+	case *ListNode:
+		for _, child := range n.Nodes {
+			walk(child, fn)
+		}
+	case *IfNode:
+		walkList(n.List, fn)
+		walkList(n.ElseList, fn)
+	case *RangeNode:
+		walkList(n.List, fn)
+		walkList(n.ElseList, fn)
+	case *WithNode:
+		walkList(n.List, fn)
+		walkList(n.ElseList, fn)
+	case *BlockNode:
+		walkList(n.List, fn)
+	case *FillNode:
+		walkList(n.List, fn)
+	}
+}
+
+// walkList visits the nodes of a list, which can be nil.
+func walkList(list *ListNode, fn func(Node) bool) {
+	if list != nil {
+		walk(list, fn)
+	}
+}
+
+// WalkPipes calls fn for every pipeline in the tree, in the order Walk
+// visits their nodes: the pipelines of actions, the conditions of {{if}},
+// {{range}} and {{with}}, and the arguments of {{template}}, {{block}} and
+// {{fill}}. Absent arguments are skipped.
+//
+// fn can modify the pipelines, e.g. to add commands or rename variables.
+func WalkPipes(tree Tree, fn func(*PipeNode)) {
+	Walk(tree, func(node Node) bool {
+		var pipe *PipeNode
+		switch n := node.(type) {
+		case *ActionNode:
+			pipe = n.Pipe
+		case *IfNode:
+			pipe = n.Pipe
+		case *RangeNode:
+			pipe = n.Pipe
+		case *WithNode:
+			pipe = n.Pipe
+		case *TemplateNode:
+			pipe = n.Pipe
+		case *BlockNode:
+			pipe = n.Pipe
+		case *FillNode:
+			pipe = n.Pipe
+		}
+		if pipe != nil {
+			fn(pipe)
+		}
+		return true
+	})
+}
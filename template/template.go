@@ -6,9 +6,15 @@ package template
 
 import (
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"code.google.com/p/sadbox/template/escape"
 	"code.google.com/p/sadbox/template/parse"
@@ -46,8 +52,35 @@ type Set struct {
 	// expose reflection to the client.
 	parseFuncs FuncMap
 	execFuncs  map[string]reflect.Value
+	mu         sync.Mutex // guards the function maps until executed is set
+	executed   uint32     // set atomically on the first execution
+	escaped    bool       // whether Escape was called
+	option     option
+	urlFilter  func(url string) bool // used by Escape; nil for the default
+	delimsErr  error                 // set by Delims; returned by parse
+	funcsErr   error                 // set by Funcs after execution; returned by Err
 }
 
+// missingKeyAction defines how to respond to indexing a map with a key that
+// is not present.
+type missingKeyAction int
+
+const (
+	mapInvalid   missingKeyAction = iota // Return an invalid reflect.Value.
+	mapZeroValue                         // Return the zero value for the map element.
+	mapError                             // Error out.
+)
+
+// option holds the execution options of a set.
+type option struct {
+	missingKey missingKeyAction
+	maxDepth   int // 0 means maxExecDepth
+}
+
+// maxExecDepth is the default limit of nested template invocations. It
+// stops infinite recursion before the stack overflows.
+const maxExecDepth = 100000
+
 // init initializes the set fields to default values.
 func (s *Set) init() {
 	if s.Tree == nil {
@@ -65,23 +98,147 @@ func (s *Set) init() {
 // subsequent calls to Parse. An empty delimiter stands for the corresponding
 // default: "{{" or "}}".
 // The return value is the set, so calls can be chained.
+//
+// Delimiters that can't be told apart, like identical ones or a delimiter
+// made of spaces, are invalid: the next call to Parse returns an error.
 func (s *Set) Delims(left, right string) *Set {
 	s.leftDelim = left
 	s.rightDelim = right
+	s.delimsErr = checkDelims(left, right)
+	return s
+}
+
+// checkDelims returns an error if the action delimiters, after replacing
+// empty ones by the defaults, can't be tokenized unambiguously.
+func checkDelims(left, right string) error {
+	if left != "" && strings.TrimSpace(left) == "" ||
+		right != "" && strings.TrimSpace(right) == "" {
+		return fmt.Errorf("template: blank delimiters %q and %q", left, right)
+	}
+	if left == "" {
+		left = "{{"
+	}
+	if right == "" {
+		right = "}}"
+	}
+	if strings.Contains(left, right) || strings.Contains(right, left) {
+		return fmt.Errorf("template: ambiguous delimiters %q and %q: "+
+			"one contains the other", left, right)
+	}
+	return nil
+}
+
+// Option sets options for the set. Options are described by strings, either
+// a simple string or "key=value". There can be at most one equals sign in an
+// option string. If the option string is unrecognized or otherwise invalid,
+// Option panics.
+//
+// Known options:
+//
+// missingkey: Control the behavior during execution if a map is indexed with
+// a key that is not present in the map.
+//
+//	"missingkey=default" or "missingkey=invalid"
+//		The default behavior: Do nothing and continue execution.
+//		If printed, the result of the index operation is the string
+//		"<no value>".
+//	"missingkey=zero"
+//		The operation returns the zero value for the map type's element.
+//	"missingkey=error"
+//		Execution stops immediately with an error.
+//
+// maxdepth: Limit the depth of nested template invocations, to stop
+// templates that invoke themselves before the stack overflows.
+//
+//	"maxdepth=N"
+//		Execution stops with an error when templates are nested more
+//		than N levels. The default is 100000.
+//
+// The return value is the set, so calls can be chained.
+func (s *Set) Option(opts ...string) *Set {
+	for _, opt := range opts {
+		s.setOption(opt)
+	}
 	return s
 }
 
+func (s *Set) setOption(opt string) {
+	if opt == "" {
+		panic("template: empty option string")
+	}
+	elems := strings.Split(opt, "=")
+	switch len(elems) {
+	case 2:
+		switch elems[0] {
+		case "missingkey":
+			switch elems[1] {
+			case "invalid", "default":
+				s.option.missingKey = mapInvalid
+				return
+			case "zero":
+				s.option.missingKey = mapZeroValue
+				return
+			case "error":
+				s.option.missingKey = mapError
+				return
+			}
+		case "maxdepth":
+			if n, err := strconv.Atoi(elems[1]); err == nil && n > 0 {
+				s.option.maxDepth = n
+				return
+			}
+		}
+	}
+	panic(fmt.Sprintf("template: unrecognized option: %q", opt))
+}
+
 // Funcs adds the elements of the argument map to the template's function map.
 // It panics if a value in the map is not a function with appropriate return
 // type. However, it is legal to overwrite elements of the map. The return
 // value is the set, so calls can be chained.
+//
+// Funcs must be called before the set is executed: the function maps are
+// read without locking during execution, so once any template in the set
+// was executed Funcs leaves the maps unchanged and records an error, which
+// is returned by Err. The set can still be executed. Use Clone to add
+// functions to an executed set:
+//
+//     if err := set.Funcs(funcs).Err(); err != nil {
+//         // do something with the error...
+//     }
 func (s *Set) Funcs(funcMap FuncMap) *Set {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if atomic.LoadUint32(&s.executed) != 0 {
+		s.funcsErr = fmt.Errorf("template: Funcs called after the set was executed")
+		return s
+	}
 	s.init()
 	addValueFuncs(s.execFuncs, funcMap)
 	addFuncs(s.parseFuncs, funcMap)
 	return s
 }
 
+// Err returns the error recorded by a call to Funcs after the set was
+// executed, if any.
+func (s *Set) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.funcsErr
+}
+
+// URLFilter sets a predicate that decides which URLs are allowed in URL
+// contexts, like href and src attributes or CSS url(...), when the set is
+// escaped. URLs it rejects are replaced by "#ZgotmplZ". By default, only
+// relative URLs and the http, https and mailto protocols are allowed.
+//
+// It must be called before Escape. The return value is the set, so calls
+// can be chained.
+func (s *Set) URLFilter(allowed func(url string) bool) *Set {
+	s.urlFilter = allowed
+	return s
+}
+
 // Clone returns a duplicate of the template, including all associated
 // templates. The actual representation is not copied, but the name space of
 // associated templates is, so further calls to Parse in the copy will add
@@ -90,6 +247,9 @@ func (s *Set) Funcs(funcMap FuncMap) *Set {
 // by adding the variants after the clone is made.
 func (s *Set) Clone() (*Set, error) {
 	ns := new(Set).Delims(s.leftDelim, s.rightDelim)
+	ns.option = s.option
+	ns.escaped = s.escaped
+	ns.urlFilter = s.urlFilter
 	ns.init()
 	for k, v := range s.parseFuncs {
 		ns.parseFuncs[k] = v
@@ -104,17 +264,59 @@ func (s *Set) Clone() (*Set, error) {
 	return ns, nil
 }
 
+// Lookup returns true if a template with the given name is defined in the
+// set.
+func (s *Set) Lookup(name string) bool {
+	_, ok := s.Tree[name]
+	return ok
+}
+
+// Remove removes the template with the given name from the set. It returns
+// an error if the template is not defined or if the set was already escaped.
+func (s *Set) Remove(name string) error {
+	if s.escaped {
+		return fmt.Errorf("template: can't remove %q after escaping", name)
+	}
+	if _, ok := s.Tree[name]; !ok {
+		return fmt.Errorf("template: template %q not defined", name)
+	}
+	delete(s.Tree, name)
+	return nil
+}
+
+// Templates returns the names of the templates defined in the set, sorted.
+func (s *Set) Templates() []string {
+	names := make([]string, 0, len(s.Tree))
+	for name, _ := range s.Tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Escape rewrites the set executing contextual HTML escaping in all
 // templates, like in the standard html/template package.
 //
 // This must be called only once, after all templates were added to the set.
+// Calling it again returns an error, and so does adding templates after
+// escaping.
 //
 // If escaping fails, all templates are removed from the set, so that unsafe
 // templates can't be executed.
 func (s *Set) Escape() (*Set, error) {
+	if s.escaped {
+		return nil, fmt.Errorf("template: set already escaped")
+	}
+	if atomic.LoadUint32(&s.executed) != 0 {
+		return nil, fmt.Errorf("template: can't escape after execution")
+	}
 	var err error
+	s.escaped = true
 	s.Tree, err = escape.EscapeTree(s.Tree)
 	s.Funcs(escape.FuncMap)
+	if s.urlFilter != nil {
+		s.Funcs(escape.URLFilterFuncs(s.urlFilter))
+	}
 	return s, err
 }
 
@@ -125,16 +327,46 @@ func (s *Set) Escape() (*Set, error) {
 // files or glob, for example, to know which file caused an error.
 // Adding templates after the set executed results in error.
 func (s *Set) parse(text, name string) (*Set, error) {
+	if s.delimsErr != nil {
+		return nil, s.delimsErr
+	}
 	s.init()
-	if tree, err := parse.Parse(text, name, s.leftDelim, s.rightDelim,
-		builtins, s.parseFuncs); err != nil {
+	tree, err := parse.Parse(text, name, s.leftDelim, s.rightDelim,
+		builtins, s.parseFuncs)
+	if err != nil {
 		return nil, err
-	} else if err = s.Tree.AddTree(tree); err != nil {
+	}
+	if err = s.AddParseTree(name, tree); err != nil {
 		return nil, err
 	}
 	return s, nil
 }
 
+// AddParseTree adds the templates from an already parsed tree to the set.
+// The name is only used in error messages, like the file names in
+// ParseFiles. If the tree defines a template that is already in the set,
+// it returns an error and no templates are added. Templates can't be added
+// after the set was escaped.
+//
+// The tree is not copied, so it must not be modified afterwards.
+func (s *Set) AddParseTree(name string, tree parse.Tree) error {
+	if s.escaped {
+		return fmt.Errorf("template: %s: can't add templates after escaping", name)
+	}
+	s.init()
+	// Check for duplicates here to report where the redefinition happened.
+	for k, v := range tree {
+		if v == nil {
+			return fmt.Errorf("template: %s: nil template %q", name, k)
+		}
+		if _, ok := s.Tree[k]; ok {
+			return fmt.Errorf("template: %s:%d: duplicated template name %q",
+				name, v.Line, k)
+		}
+	}
+	return s.Tree.AddTree(tree)
+}
+
 // Parse parses the given text and adds the resulting templates to the set.
 // If an error occurs, parsing stops and the returned set is nil; otherwise
 // it is s.
@@ -178,6 +410,62 @@ func (s *Set) ParseGlob(pattern string) (*Set, error) {
 	return s.ParseFiles(filenames...)
 }
 
+// ParseGlobRecursive parses the template definitions in the files with the
+// given extension, e.g. ".tmpl", found in root and its subdirectories, and
+// adds the resulting templates to the set. Directories are walked in lexical
+// order by filepath.WalkDir and at least one file must match. If an error
+// occurs, parsing stops and the returned set is nil; otherwise it is s.
+func (s *Set) ParseGlobRecursive(root, ext string) (*Set, error) {
+	var filenames []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ext) {
+			filenames = append(filenames, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("template: no %s files found in %s", ext, root)
+	}
+	return s.ParseFiles(filenames...)
+}
+
+// ParseFS is like ParseGlob but reads from the file system fsys instead of
+// the host operating system's file system. It accepts a list of glob
+// patterns, processed by fs.Glob, and each must match at least one file.
+// If an error occurs, parsing stops and the returned set is nil; otherwise
+// it is s.
+func (s *Set) ParseFS(fsys fs.FS, patterns ...string) (*Set, error) {
+	var filenames []string
+	for _, pattern := range patterns {
+		list, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(list) == 0 {
+			return nil, fmt.Errorf("template: pattern matches no files: %#q",
+				pattern)
+		}
+		filenames = append(filenames, list...)
+	}
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("template: no files named in call to ParseFS")
+	}
+	for _, filename := range filenames {
+		if b, err := fs.ReadFile(fsys, filename); err != nil {
+			return nil, err
+		} else if _, err = s.parse(string(b), filename); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
 // Convenience parsing wrappers -----------------------------------------------
 
 // Must is a helper that wraps a call to a function returning (*Set, error)
@@ -212,3 +500,19 @@ func ParseFiles(filenames ...string) (*Set, error) {
 func ParseGlob(pattern string) (*Set, error) {
 	return new(Set).ParseGlob(pattern)
 }
+
+// ParseGlobRecursive creates a new Set with the template definitions from the
+// files with the given extension found in root and its subdirectories. At
+// least one file must match. If an error occurs, parsing stops and the
+// returned set is nil.
+func ParseGlobRecursive(root, ext string) (*Set, error) {
+	return new(Set).ParseGlobRecursive(root, ext)
+}
+
+// ParseFS creates a new Set with the template definitions from the files in
+// fsys matched by the patterns. Each pattern is processed by fs.Glob and must
+// match at least one file. If an error occurs, parsing stops and the returned
+// set is nil.
+func ParseFS(fsys fs.FS, patterns ...string) (*Set, error) {
+	return new(Set).ParseFS(fsys, patterns...)
+}
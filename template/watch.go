@@ -0,0 +1,116 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package template
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// WatchedSet wraps a Set that can be rebuilt from its sources, typically to
+// pick up template files edited during development.
+//
+// The set is rebuilt only when Reload is called; there is no file system
+// notification. A successful Reload swaps the whole set at once: Executes
+// already in progress finish with the set they started with, and later
+// calls use the new one. A failed Reload keeps the current set.
+//
+//     w, err := template.WatchGlob(new(template.Set), "templates/*.html")
+//     if err != nil {
+//         // do something with the parsing error...
+//     }
+//     // In a development handler, before executing:
+//     if err := w.Reload(); err != nil {
+//         // report the error; w still holds the previous templates.
+//     }
+//     err = w.Execute(wr, "page", data)
+type WatchedSet struct {
+	mu   sync.RWMutex
+	set  *Set
+	load func() (*Set, error)
+}
+
+// Watch creates a WatchedSet whose templates are built by calling load. It
+// is called once now and again on each Reload, and must return a new Set
+// every time, because sets can't be modified once executed.
+//
+// Use Watch when the set needs more than parsing, e.g. to be escaped:
+//
+//     w, err := template.Watch(func() (*template.Set, error) {
+//         s, err := template.ParseGlob("templates/*.html")
+//         if err != nil {
+//             return nil, err
+//         }
+//         return s.Escape()
+//     })
+func Watch(load func() (*Set, error)) (*WatchedSet, error) {
+	w := &WatchedSet{load: load}
+	if err := w.Reload(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// WatchGlob creates a WatchedSet that parses the files matched by the
+// patterns, as ParseGlob does, into a clone of base. Delimiters, options and
+// functions are set on base beforehand; base itself is not modified, and it
+// can't be escaped. The patterns are matched again on each Reload, so new
+// files are picked up and removed ones are dropped.
+func WatchGlob(base *Set, patterns ...string) (*WatchedSet, error) {
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("template: no patterns named in call to WatchGlob")
+	}
+	if base.escaped {
+		return nil, fmt.Errorf("template: can't watch an escaped set")
+	}
+	return Watch(func() (*Set, error) {
+		s, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+		for _, pattern := range patterns {
+			if _, err = s.ParseGlob(pattern); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	})
+}
+
+// Reload rebuilds the set from its sources. If an error occurs, the current
+// set is kept and the error is returned.
+func (w *WatchedSet) Reload() error {
+	s, err := w.load()
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return fmt.Errorf("template: reload returned a nil set")
+	}
+	w.mu.Lock()
+	w.set = s
+	w.mu.Unlock()
+	return nil
+}
+
+// Set returns the current set. It is not affected by later reloads.
+func (w *WatchedSet) Set() *Set {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.set
+}
+
+// Execute applies the template with the given name from the current set to
+// the specified data object, writing the output to wr.
+func (w *WatchedSet) Execute(wr io.Writer, name string, data interface{}) error {
+	return w.Set().Execute(wr, name, data)
+}
+
+// ExecuteString applies the template with the given name from the current
+// set to the specified data object and returns the output as a string.
+func (w *WatchedSet) ExecuteString(name string, data interface{}) (string, error) {
+	return w.Set().ExecuteString(name, data)
+}
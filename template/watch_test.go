@@ -0,0 +1,92 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWatchGlob(t *testing.T) {
+	dir := t.TempDir()
+	page := filepath.Join(dir, "page.tmpl")
+	write := func(name, text string) {
+		if err := os.WriteFile(name, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(w *WatchedSet, name, want string) {
+		got, err := w.ExecuteString(name, "x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: expected %q got %q", name, want, got)
+		}
+	}
+
+	write(page, `{{define "page"}}v1 {{upper .}}{{end}}`)
+	base := new(Set).Funcs(FuncMap{"upper": strings.ToUpper})
+	w, err := WatchGlob(base, filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(w, "page", "v1 X")
+	old := w.Set()
+
+	// Edit the file and add a new one.
+	write(page, `{{define "page"}}v2 {{upper .}}{{template "footer"}}{{end}}`)
+	write(filepath.Join(dir, "footer.tmpl"), `{{define "footer"}}!{{end}}`)
+	expect(w, "page", "v1 X")
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	expect(w, "page", "v2 X!")
+	if out, err := old.ExecuteString("page", "x"); err != nil || out != "v1 X" {
+		t.Errorf("old set: expected %q got %q, %v", "v1 X", out, err)
+	}
+	if base.Lookup("page") {
+		t.Error("base set was modified")
+	}
+
+	// A broken file keeps the current set.
+	write(page, `{{define "page"}}{{if}}{{end}}`)
+	if err := w.Reload(); err == nil {
+		t.Error("expected error reloading a broken file")
+	}
+	expect(w, "page", "v2 X!")
+}
+
+func TestWatchEscaped(t *testing.T) {
+	text := `{{define "a"}}<b>{{.}}</b>{{end}}`
+	w, err := Watch(func() (*Set, error) {
+		s, err := Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		return s.Escape()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text = `{{define "a"}}<i>{{.}}</i>{{end}}`
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := w.ExecuteString("a", "<x>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<i>&lt;x&gt;</i>"; out != want {
+		t.Errorf("expected %q got %q", want, out)
+	}
+	escaped, _ := Parse(text)
+	escaped.Escape()
+	if _, err := WatchGlob(escaped, "*.tmpl"); err == nil {
+		t.Error("expected error watching an escaped set")
+	}
+}
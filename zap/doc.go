@@ -58,6 +58,25 @@ When we compile this template, the result will be a template with the layout
 from the "base" template, and the "content" block replaced by the one it
 defines.
 
+Zap fails if a template defines a block that the template it extends doesn't
+have, as in a misspelled block name, because that block would never be
+rendered. Blocks nested inside an overriding block are new placeholders and
+can have any name.
+
+A block can also include the content of the block it replaces using the
+{{super}} action:
+
+	{{define "tutorial" "base"}}
+	  {{block "content"}}
+		{{super}}
+		<p>Welcome to the Zap tutorial.</p>
+	  {{end}}
+	{{end}}
+
+Here the placeholder paragraph from "base" is rendered before the welcome
+message. In a chain of templates, {{super}} refers to the block from the
+template being extended directly.
+
 The zap package can compute this, and output templates that text/template or
 html/template can execute. Here's how:
 
@@ -72,5 +91,50 @@ html/template can execute. Here's how:
 
 After this, the compiled templates are written to the writer passed to Zap
 and can be used with the standard template packages.
+
+A block can be marked as required to force templates that extend its
+template to override it:
+
+	{{block "content" required}}{{end}}
+
+Zap then fails if a template extending "base" doesn't define "content".
+The requirement applies to the templates extending the one that declares
+the block; a block that overrides it can be marked as required again.
+
+Like {{template}}, a block can take a pipeline to set dot inside it:
+
+	{{block "content" .Page}}
+	  <p>{{.Text}}</p>
+	{{end}}
+
+Blocks that override it use the same dot, unless they set their own
+pipeline. Such a block is compiled to a separate template, named after the
+template and the block, e.g. "tutorial#content", and called with
+{{template}}; as a consequence, variables defined outside the block are not
+visible inside it.
+
+A file can declare a namespace before its definitions, so that templates
+from different files don't clash:
+
+	{{namespace "blog.admin"}}
+	{{define "page" "base"}}
+	  {{block "content"}}{{template ".menu"}}{{end}}
+	{{end}}
+	{{define "menu"}}...{{end}}
+
+Templates defined after the declaration are qualified with the namespace,
+here "blog.admin.page" and "blog.admin.menu". Names given to {{template}}
+and to {{define}} as a parent are absolute, like "blog.admin.menu" or
+"base", unless they start with a dot: ".menu" refers to the template in
+the current namespace.
+
+To execute the templates in the same process, ZapToSet compiles them and
+loads the result in a set from the sadbox template package:
+
+	set, err := zapper.ZapToSet()
+	if err != nil {
+		// ... do something with the compilation error
+	}
+	err = set.Execute(w, "tutorial", data)
 */
 package zap
@@ -2,6 +2,8 @@ package parse
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 )
 
 /*
@@ -42,19 +44,32 @@ func Compile(treeSet map[string]*Tree) error {
 		}
 		for len(names) > 0 {
 			// inline in reverse order
-			inlineParent(treeSet, names[len(names)-1])
+			if err := inlineParent(treeSet, names[len(names)-1]); err != nil {
+				return err
+			}
 			names = names[:len(names)-1]
 		}
 	}
-	for _, v := range treeSet {
-		if err := inlineBlocks(v.Root.List); err != nil {
+	extracted := make(map[string]*Tree)
+	for name, v := range treeSet {
+		if err := inlineBlocks(v.Root.List, name, extracted); err != nil {
 			return err
 		}
 	}
+	for name, v := range extracted {
+		if treeSet[name] != nil {
+			return fmt.Errorf("template %q conflicts with a block of the same name", name)
+		}
+		treeSet[name] = v
+	}
 	return nil
 }
 
-func inlineParent(treeSet map[string]*Tree, name string) {
+// inlineParent replaces a template by a copy of its parent, with the blocks
+// it defines replacing the ones from the parent. It returns an error if a
+// required block from the parent is not overridden, or if the template
+// defines a block that the parent doesn't have.
+func inlineParent(treeSet map[string]*Tree, name string) error {
 	// to be discarded
 	define := treeSet[name].Root
 	// to replace the original
@@ -64,18 +79,51 @@ func inlineParent(treeSet map[string]*Tree, name string) {
 	extractBlocks(src, define.List)
 	dst := make(map[string]*BlockNode)
 	extractBlocks(dst, parent.List)
+	// The blocks defined at the top level must override a block from the
+	// parent; otherwise they are discarded, which is most likely a typo.
+	// Blocks nested in them are new placeholders.
+	for _, node := range define.List.Nodes {
+		if block, ok := node.(*BlockNode); ok && dst[block.Name] == nil {
+			return fmt.Errorf("template %q defines block %q, which is not in %q",
+				name, block.Name, define.Parent)
+		}
+	}
+	overridden := make(map[*BlockNode]bool)
 	for k, v := range dst {
 		if block := src[k]; block != nil {
+			expandSuper(block.List, v.List)
 			v.List = block.List
+			if block.Pipe != nil {
+				v.Pipe = block.Pipe
+			}
+			v.Required = block.Required
+			overridden[v] = true
+		}
+	}
+	// Check the blocks that remain after overriding: required blocks nested
+	// in an overridden block are gone.
+	blocks := make(map[string]*BlockNode)
+	extractBlocks(blocks, parent.List)
+	var missing []string
+	for k, v := range blocks {
+		if v.Required && !overridden[v] && src[k] != v {
+			missing = append(missing, k)
 		}
 	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("template %q doesn't override required block %q",
+			name, missing[0])
+	}
 	treeSet[name].Root = parent
+	return nil
 }
 
 // inlineParentList returns the parent templates that need inlining for a given
 // template name.  It returns an error if a dependency is not found or
 // recursive dependency is detected.
 func inlineParentList(treeSet map[string]*Tree, name string) (deps []string, err error) {
+	visited := make(map[string]bool)
 	for {
 		define := treeSet[name]
 		if define == nil || define.Root == nil {
@@ -85,12 +133,12 @@ func inlineParentList(treeSet map[string]*Tree, name string) (deps []string, err
 		if parentName == "" {
 			break
 		}
-		for _, v := range deps {
-			if v == name {
-				deps = append(deps, name)
-				return nil, fmt.Errorf("impossible recursion: %#v", deps)
-			}
+		if visited[name] {
+			chain := append(deps, name)
+			return nil, fmt.Errorf("impossible recursion: %s",
+				strings.Join(chain, " -> "))
 		}
+		visited[name] = true
 		deps = append(deps, name)
 		name = parentName
 	}
@@ -108,6 +156,9 @@ func extractBlocks(dst map[string]*BlockNode, n Node) {
 		extractBlocks(dst, n.List)
 		extractBlocks(dst, n.ElseList)
 	case *ListNode:
+		if n == nil {
+			return
+		}
 		for _, node := range n.Nodes {
 			extractBlocks(dst, node)
 		}
@@ -120,30 +171,90 @@ func extractBlocks(dst map[string]*BlockNode, n Node) {
 	}
 }
 
-func inlineBlocks(n Node) error {
+// expandSuper replaces the {{super}} actions from a block by a copy of the
+// contents of the parent block it overrides. Nested blocks are not visited
+// because a {{super}} inside them refers to their own parent block.
+func expandSuper(n Node, parent *ListNode) {
+	switch n := n.(type) {
+	case *IfNode:
+		expandSuper(n.List, parent)
+		expandSuper(n.ElseList, parent)
+	case *ListNode:
+		if n == nil {
+			return
+		}
+		for k, node := range n.Nodes {
+			if _, ok := node.(*SuperNode); ok {
+				n.Nodes[k] = parent.CopyList()
+			} else {
+				expandSuper(node, parent)
+			}
+		}
+	case *RangeNode:
+		expandSuper(n.List, parent)
+		expandSuper(n.ElseList, parent)
+	case *WithNode:
+		expandSuper(n.List, parent)
+		expandSuper(n.ElseList, parent)
+	}
+}
+
+// inlineBlocks replaces the blocks in the template with the given name by
+// their contents. A block with a pipeline is moved to its own template,
+// added to extracted, and replaced by a {{template}} action that passes the
+// pipeline as dot.
+func inlineBlocks(n Node, name string, extracted map[string]*Tree) error {
 	switch n := n.(type) {
 	case *BlockNode:
 		return fmt.Errorf("block node can't be replaced by itself")
+	case *SuperNode:
+		return fmt.Errorf("line %d: {{super}} used without a parent block", n.Line)
 	case *DefineNode:
-		inlineBlocks(n.List)
+		return inlineBlocks(n.List, name, extracted)
 	case *IfNode:
-		inlineBlocks(n.List)
-		inlineBlocks(n.ElseList)
+		if err := inlineBlocks(n.List, name, extracted); err != nil {
+			return err
+		}
+		return inlineBlocks(n.ElseList, name, extracted)
 	case *ListNode:
+		if n == nil {
+			return nil
+		}
 		for k, node := range n.Nodes {
 			if block, ok := node.(*BlockNode); ok {
-				n.Nodes[k] = block.List
-				inlineBlocks(block.List)
-			} else {
-				inlineBlocks(node)
+				if block.Pipe != nil {
+					blockName := blockTemplateName(name, block.Name)
+					extracted[blockName] = &Tree{
+						Name: blockName,
+						Root: newDefine(block.Line, blockName, "", block.List),
+					}
+					n.Nodes[k] = newTemplate(block.Line, blockName, block.Pipe)
+				} else {
+					n.Nodes[k] = block.List
+				}
+				node = block.List
+			}
+			if err := inlineBlocks(node, name, extracted); err != nil {
+				return err
 			}
 		}
 	case *RangeNode:
-		inlineBlocks(n.List)
-		inlineBlocks(n.ElseList)
+		if err := inlineBlocks(n.List, name, extracted); err != nil {
+			return err
+		}
+		return inlineBlocks(n.ElseList, name, extracted)
 	case *WithNode:
-		inlineBlocks(n.List)
-		inlineBlocks(n.ElseList)
+		if err := inlineBlocks(n.List, name, extracted); err != nil {
+			return err
+		}
+		return inlineBlocks(n.ElseList, name, extracted)
 	}
 	return nil
 }
+
+// blockTemplateName returns the name of the template generated by Compile
+// for a block with a pipeline, given the names of the template that contains
+// it and of the block.
+func blockTemplateName(template, block string) string {
+	return template + "#" + block
+}
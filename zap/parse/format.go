@@ -0,0 +1,80 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package parse
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Format returns the source representation of a node, like String, but
+// using the given action delimiters. An empty delimiter stands for the
+// corresponding default: "{{" or "}}".
+func Format(n Node, left, right string) string {
+	if left == "" {
+		left = leftDelim
+	}
+	if right == "" {
+		right = rightDelim
+	}
+	b := new(bytes.Buffer)
+	format(b, n, left, right)
+	return b.String()
+}
+
+// format writes the source representation of a node to b. Text is written
+// as is; only actions are wrapped by the delimiters.
+func format(b *bytes.Buffer, n Node, left, right string) {
+	switch n := n.(type) {
+	case *ActionNode:
+		fmt.Fprintf(b, "%s%s%s", left, n.Pipe, right)
+	case *BlockNode:
+		b.WriteString(left + n.action() + right)
+		format(b, n.List, left, right)
+		b.WriteString(left + "end" + right)
+	case *DefineNode:
+		if n.Parent != "" {
+			fmt.Fprintf(b, "%sdefine %q %q%s", left, n.Name, n.Parent, right)
+		} else {
+			fmt.Fprintf(b, "%sdefine %q%s", left, n.Name, right)
+		}
+		format(b, n.List, left, right)
+		b.WriteString(left + "end" + right)
+	case *IfNode:
+		formatBranch(b, "if", &n.BranchNode, left, right)
+	case *ListNode:
+		for _, node := range n.Nodes {
+			format(b, node, left, right)
+		}
+	case *RangeNode:
+		formatBranch(b, "range", &n.BranchNode, left, right)
+	case *SuperNode:
+		b.WriteString(left + "super" + right)
+	case *TemplateNode:
+		if n.Pipe == nil {
+			fmt.Fprintf(b, "%stemplate %q%s", left, n.Name, right)
+		} else {
+			fmt.Fprintf(b, "%stemplate %q %s%s", left, n.Name, n.Pipe, right)
+		}
+	case *TextNode:
+		b.Write(n.Text)
+	case *WithNode:
+		formatBranch(b, "with", &n.BranchNode, left, right)
+	default:
+		b.WriteString(n.String())
+	}
+}
+
+// formatBranch writes the source representation of an if, range or with
+// action to b.
+func formatBranch(b *bytes.Buffer, name string, n *BranchNode, left, right string) {
+	fmt.Fprintf(b, "%s%s %s%s", left, name, n.Pipe, right)
+	format(b, n.List, left, right)
+	if n.ElseList != nil {
+		b.WriteString(left + "else" + right)
+		format(b, n.ElseList, left, right)
+	}
+	b.WriteString(left + "end" + right)
+}
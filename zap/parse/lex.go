@@ -56,17 +56,19 @@ const (
 	itemText       // plain text
 	itemVariable   // variable starting with '$', such as '$' or  '$1' or '$hello'.
 	// Keywords appear after all the rest.
-	itemKeyword  // used only to delimit the keywords
-	itemDot      // the cursor, spelled '.'.
-	itemBlock    // block keyword
-	itemDefine   // define keyword
-	itemElse     // else keyword
-	itemEnd      // end keyword
-	itemIf       // if keyword
-	itemNil      // the untyped nil constant, easiest to treat as a keyword
-	itemRange    // range keyword
-	itemTemplate // template keyword
-	itemWith     // with keyword
+	itemKeyword   // used only to delimit the keywords
+	itemDot       // the cursor, spelled '.'.
+	itemBlock     // block keyword
+	itemDefine    // define keyword
+	itemElse      // else keyword
+	itemEnd       // end keyword
+	itemIf        // if keyword
+	itemNamespace // namespace keyword
+	itemNil       // the untyped nil constant, easiest to treat as a keyword
+	itemRange     // range keyword
+	itemSuper     // super keyword
+	itemTemplate  // template keyword
+	itemWith      // with keyword
 )
 
 // Make the types prettyprint.
@@ -91,16 +93,18 @@ var itemName = map[itemType]string{
 	itemVariable:     "variable",
 
 	// keywords
-	itemDot:      ".",
-	itemBlock:    "block",
-	itemDefine:   "define",
-	itemElse:     "else",
-	itemIf:       "if",
-	itemEnd:      "end",
-	itemNil:      "nil",
-	itemRange:    "range",
-	itemTemplate: "template",
-	itemWith:     "with",
+	itemDot:       ".",
+	itemBlock:     "block",
+	itemDefine:    "define",
+	itemElse:      "else",
+	itemIf:        "if",
+	itemEnd:       "end",
+	itemNamespace: "namespace",
+	itemNil:       "nil",
+	itemRange:     "range",
+	itemSuper:     "super",
+	itemTemplate:  "template",
+	itemWith:      "with",
 }
 
 func (i itemType) String() string {
@@ -112,16 +116,18 @@ func (i itemType) String() string {
 }
 
 var key = map[string]itemType{
-	".":        itemDot,
-	"block":    itemBlock,
-	"define":   itemDefine,
-	"else":     itemElse,
-	"end":      itemEnd,
-	"if":       itemIf,
-	"range":    itemRange,
-	"nil":      itemNil,
-	"template": itemTemplate,
-	"with":     itemWith,
+	".":         itemDot,
+	"block":     itemBlock,
+	"define":    itemDefine,
+	"else":      itemElse,
+	"end":       itemEnd,
+	"if":        itemIf,
+	"namespace": itemNamespace,
+	"range":     itemRange,
+	"nil":       itemNil,
+	"super":     itemSuper,
+	"template":  itemTemplate,
+	"with":      itemWith,
 }
 
 const eof = -1
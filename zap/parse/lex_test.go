@@ -70,6 +70,17 @@ var lexTests = []lexTest{
 		tRight,
 		tEOF,
 	}},
+	{"decimal points", "{{.5 0.5 5. -.5 .5e3 .5i}}", []item{
+		tLeft,
+		{itemNumber, 0, ".5"},
+		{itemNumber, 0, "0.5"},
+		{itemNumber, 0, "5."},
+		{itemNumber, 0, "-.5"},
+		{itemNumber, 0, ".5e3"},
+		{itemNumber, 0, ".5i"},
+		tRight,
+		tEOF,
+	}},
 	{"characters", `{{'a' '\n' '\'' '\\' '\u00FF' '\xFF' '本'}}`, []item{
 		tLeft,
 		{itemCharConstant, 0, `'a'`},
@@ -51,6 +51,7 @@ const (
 	NodePipe                       // A pipeline of commands.
 	NodeRange                      // A range action.
 	NodeString                     // A string constant.
+	NodeSuper                      // A super action.
 	NodeTemplate                   // A template invocation action.
 	NodeVariable                   // A $ variable.
 	NodeWith                       // A with action.
@@ -662,12 +663,33 @@ func (d *DefineNode) Copy() Node {
 	return d.CopyDefine()
 }
 
+// SuperNode represents a {{super}} action. It is replaced by the contents
+// of the parent block during compilation.
+type SuperNode struct {
+	NodeType
+	Line int // The line number in the input.
+}
+
+func newSuper(line int) *SuperNode {
+	return &SuperNode{NodeType: NodeSuper, Line: line}
+}
+
+func (s *SuperNode) String() string {
+	return "{{super}}"
+}
+
+func (s *SuperNode) Copy() Node {
+	return newSuper(s.Line)
+}
+
 // BlockNode represents a {{block}} action.
 type BlockNode struct {
 	NodeType
-	Line int       // The line number in the input.
-	Name string    // The name of the block (unquoted).
-	List *ListNode // The contents of the block.
+	Line     int       // The line number in the input.
+	Name     string    // The name of the block (unquoted).
+	Pipe     *PipeNode // The command to evaluate as dot for the block, if any.
+	List     *ListNode // The contents of the block.
+	Required bool      // Whether templates extending this one must override it.
 }
 
 func newBlock(line int, name string, list *ListNode) *BlockNode {
@@ -675,12 +697,28 @@ func newBlock(line int, name string, list *ListNode) *BlockNode {
 }
 
 func (b *BlockNode) String() string {
-	return fmt.Sprintf("{{block %q}}%s{{end}}", b.Name, b.List)
+	return fmt.Sprintf("{{%s}}%s{{end}}", b.action(), b.List)
 	//return b.List.String()
 }
 
+// action returns the contents of the opening action of the block, without
+// delimiters.
+func (b *BlockNode) action() string {
+	s := fmt.Sprintf("block %q", b.Name)
+	if b.Required {
+		s += " required"
+	}
+	if b.Pipe != nil {
+		s += " " + b.Pipe.String()
+	}
+	return s
+}
+
 func (b *BlockNode) CopyBlock() *BlockNode {
-	return newBlock(b.Line, b.Name, b.List.CopyList())
+	n := newBlock(b.Line, b.Name, b.List.CopyList())
+	n.Pipe = b.Pipe.CopyPipe()
+	n.Required = b.Required
+	return n
 }
 
 func (b *BlockNode) Copy() Node {
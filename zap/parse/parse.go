@@ -25,6 +25,7 @@ type Tree struct {
 	peekCount int
 	vars      []string              // variables defined at the moment.
 	blocks    map[string]*BlockNode // declared blocks, inlined later.
+	namespace string                // set by {{namespace}}; qualifies names.
 }
 
 // Parse returns a map from template name to parse.Tree, created by parsing the
@@ -196,9 +197,11 @@ func IsEmptyTree(n Node) bool {
 		return true
 	case *ActionNode:
 	case *BlockNode:
-		return IsEmptyTree(n.List)
+		// Required blocks and blocks setting dot matter even when empty.
+		return !n.Required && n.Pipe == nil && IsEmptyTree(n.List)
 	case *DefineNode:
-		return IsEmptyTree(n.List)
+		// A template extending another one has its parent's content.
+		return n.Parent == "" && IsEmptyTree(n.List)
 	case *IfNode:
 	case *ListNode:
 		for _, node := range n.Nodes {
@@ -208,6 +211,7 @@ func IsEmptyTree(n Node) bool {
 		}
 		return true
 	case *RangeNode:
+	case *SuperNode:
 	case *TemplateNode:
 	case *TextNode:
 		return len(bytes.TrimSpace(n.Text)) == 0
@@ -223,13 +227,23 @@ func IsEmptyTree(n Node) bool {
 // It runs to EOF.
 func (t *Tree) parse(treeSet map[string]*Tree) (next Node) {
 	list := newList()
+	defined := false
 	for t.peek().typ != itemEOF {
 		if t.peek().typ == itemLeftDelim {
 			delim := t.next()
-			if t.next().typ == itemDefine {
+			switch t.next().typ {
+			case itemDefine:
 				newT := New("definition") // name will be updated once we know it.
 				newT.startParse(t.funcs, t.lex)
+				newT.namespace = t.namespace
 				newT.parseDefinition(treeSet)
+				defined = true
+				continue
+			case itemNamespace:
+				if defined || t.namespace != "" {
+					t.errorf("namespace must be declared once, before any define clause")
+				}
+				t.parseNamespace()
 				continue
 			}
 			t.backup2(delim)
@@ -244,6 +258,46 @@ func (t *Tree) parse(treeSet map[string]*Tree) (next Node) {
 	return nil
 }
 
+// parseNamespace parses a {{namespace "foo.bar"}} declaration. The
+// "namespace" keyword has already been scanned.
+func (t *Tree) parseNamespace() {
+	const context = "namespace declaration"
+	token := t.expectOneOf(itemString, itemRawString, context)
+	ns, err := strconv.Unquote(token.val)
+	if err != nil {
+		t.error(err)
+	}
+	for _, part := range strings.Split(ns, ".") {
+		if part == "" || strings.IndexFunc(part, unicode.IsSpace) >= 0 {
+			t.errorf("bad namespace %q", ns)
+		}
+	}
+	t.expect(itemRightDelim, context)
+	t.namespace = ns
+}
+
+// qualify returns the full name of a template defined in the current
+// namespace.
+func (t *Tree) qualify(name string) string {
+	if t.namespace == "" {
+		return name
+	}
+	return t.namespace + "." + name
+}
+
+// resolve returns the full name of a template referenced in the current
+// namespace. Names starting with a dot are relative to the namespace;
+// other names are used as is.
+func (t *Tree) resolve(name string) string {
+	if !strings.HasPrefix(name, ".") {
+		return name
+	}
+	if t.namespace == "" {
+		t.errorf("relative template name %q used outside a namespace", name)
+	}
+	return t.namespace + name
+}
+
 // parseDefinition parses a {{define}} ...  {{end}} template definition and
 // installs the definition in the treeSet map.  The "define" keyword has
 // already been scanned.
@@ -256,6 +310,7 @@ func (t *Tree) parseDefinition(treeSet map[string]*Tree) {
 	if err != nil {
 		t.error(err)
 	}
+	t.Name = t.qualify(t.Name)
 	var parent string
 	var list *ListNode
 	switch token := t.next(); token.typ {
@@ -273,6 +328,7 @@ func (t *Tree) parseDefinition(treeSet map[string]*Tree) {
 		if parent == "" {
 			t.errorf("parent template name can't be empty in define clause")
 		}
+		parent = t.resolve(parent)
 		t.expect(itemRightDelim, context)
 		list = t.blockList(context)
 	default:
@@ -294,7 +350,7 @@ func (t *Tree) blockList(context string) (list *ListNode) {
 			t.errorf("unexpected EOF")
 		case itemText:
 			if strings.TrimSpace(token.val) != "" {
-				t.unexpected(token, context)
+				t.notBlock(token, context)
 			}
 		case itemLeftDelim:
 			switch token = t.next(); token.typ {
@@ -304,14 +360,21 @@ func (t *Tree) blockList(context string) (list *ListNode) {
 				t.endControl()
 				return list
 			default:
-
-				t.unexpected(token, context)
+				t.notBlock(token, context)
 			}
+		case itemError:
+			t.errorf("%s", token.val)
 		}
 	}
 	return
 }
 
+// notBlock complains about content other than blocks in a template that
+// extends another one, and terminates processing.
+func (t *Tree) notBlock(token item, context string) {
+	t.errorf("unexpected %s in %s: a template that extends another can only define blocks", token, context)
+}
+
 // itemList:
 //	textOrAction*
 // Terminates at {{end}} or {{else}}, returned separately.
@@ -360,6 +423,8 @@ func (t *Tree) action() (n Node) {
 		return t.ifControl()
 	case itemRange:
 		return t.rangeControl()
+	case itemSuper:
+		return t.superControl()
 	case itemTemplate:
 		return t.templateControl()
 	case itemWith:
@@ -479,6 +544,14 @@ func (t *Tree) elseControl() Node {
 	return newElse(t.lex.lineNumber())
 }
 
+// Super:
+//	{{super}}
+// Super keyword is past.
+func (t *Tree) superControl() Node {
+	t.expect(itemRightDelim, "super")
+	return newSuper(t.lex.lineNumber())
+}
+
 // Template:
 //	{{template stringValue pipeline}}
 // Template keyword is past.  The name must be something that can evaluate
@@ -491,7 +564,7 @@ func (t *Tree) templateControl() Node {
 		if err != nil {
 			t.error(err)
 		}
-		name = s
+		name = t.resolve(s)
 	default:
 		t.unexpected(token, "template invocation")
 	}
@@ -505,8 +578,11 @@ func (t *Tree) templateControl() Node {
 }
 
 // Block:
-//	{{block stringValue}} itemList {{end}}
+//	{{block stringValue ["required"] [pipeline]}} itemList {{end}}
 // Block keyword is past.
+//
+// When the pipeline is present, it sets dot inside the block, like in
+// {{template}}, and variables from outside the block are not visible.
 func (t *Tree) blockControl() *BlockNode {
 	const context = "block definition"
 	line := t.lex.lineNumber()
@@ -515,12 +591,31 @@ func (t *Tree) blockControl() *BlockNode {
 	if err != nil {
 		t.error(err)
 	}
-	t.expect(itemRightDelim, context)
+	required := false
+	if token = t.next(); token.typ == itemIdentifier && token.val == "required" {
+		required = true
+	} else {
+		t.backup()
+	}
+	var pipe *PipeNode
+	vars := t.vars
+	if t.next().typ != itemRightDelim {
+		t.backup()
+		pipe = t.pipeline(context)
+		if len(pipe.Decl) > 0 {
+			t.errorf("variable declaration in %s", context)
+		}
+		// The block is compiled to a separate template.
+		t.vars = []string{"$"}
+	}
 	list, end := t.itemList()
 	if end.Type() != nodeEnd {
 		t.errorf("expected end in %s; found %s", context, end)
 	}
+	t.vars = vars
 	b := newBlock(line, name, list)
+	b.Pipe = pipe
+	b.Required = required
 	t.addBlock(b)
 	return b
 }
@@ -598,7 +693,7 @@ func (t *Tree) hasFunction(name string) bool {
 		if funcMap == nil {
 			continue
 		}
-		if funcMap[name] != nil {
+		if _, ok := funcMap[name]; ok {
 			return true
 		}
 	}
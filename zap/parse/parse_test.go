@@ -37,6 +37,9 @@ var numberTests = []numberTest{
 	{"1e9", true, true, true, false, 1e9, 1e9, 1e9, 0},
 	{"-1e9", true, false, true, false, -1e9, 0, -1e9, 0},
 	{"-1.2", false, false, true, false, 0, 0, -1.2, 0},
+	{".5", false, false, true, false, 0, 0, .5, 0},
+	{"-.5", false, false, true, false, 0, 0, -.5, 0},
+	{"5.", true, true, true, false, 5, 5, 5, 0},
 	{"1e19", false, true, true, false, 0, 1e19, 1e19, 0},
 	{"-1e19", false, false, true, false, 0, 0, -1e19, 0},
 	{"4i", false, false, false, true, 0, 0, 0, 4i},
@@ -5,11 +5,16 @@
 package zap
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"path/filepath"
+	"reflect"
+	"sort"
 
+	"code.google.com/p/sadbox/template"
 	"code.google.com/p/sadbox/zap/parse"
 )
 
@@ -48,15 +53,17 @@ func (z *Zapper) addTree(t map[string]*parse.Tree) error {
 }
 
 // Delims sets the template delimiters to the specified strings, to be used in
-// subsequent calls to Zap. An empty delimiter stands for the corresponding
-// default: {{ or }}.
+// subsequent calls to Parse and in the output of Zap. An empty delimiter
+// stands for the corresponding default: {{ or }}.
 func (z *Zapper) Delims(left, right string) *Zapper {
 	z.leftDelim = left
 	z.rightDelim = right
 	return z
 }
 
-// Funcs adds template functions to be recognized by the zapper.
+// Funcs adds template functions to be recognized by the zapper. Only the
+// names are used to parse, so the values can be nil unless the templates
+// are loaded with ZapToSet.
 func (z *Zapper) Funcs(funcs map[string]interface{}) *Zapper {
 	z.init()
 	for k, v := range funcs {
@@ -65,19 +72,81 @@ func (z *Zapper) Funcs(funcs map[string]interface{}) *Zapper {
 	return z
 }
 
+// Templates returns the names of the parsed templates, including the ones
+// extending other templates, in sorted order. Zapping doesn't change the
+// list: the templates generated for blocks are not included.
+func (z *Zapper) Templates() []string {
+	names := make([]string, 0, len(z.tree))
+	for k := range z.tree {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns true if a template with the given name has been parsed.
+func (z *Zapper) Lookup(name string) bool {
+	return z.tree[name] != nil
+}
+
 // Zap compiles all parsed templates and writes the result to the given writer.
 // The resulting template is guaranteed to be compatible with the template
-// language from text/template and html/template packages.
+// language from text/template and html/template packages, and uses the
+// delimiters set by Delims.
 func (z *Zapper) Zap(w io.Writer) error {
-	if err := parse.Compile(z.tree); err != nil {
+	tree, err := z.compile()
+	if err != nil {
 		return err
 	}
-	for _, v := range z.tree {
-		fmt.Fprint(w, v.Root)
+	// Sort the names so that the output is deterministic.
+	names := make([]string, 0, len(tree))
+	for k, _ := range tree {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprint(w, parse.Format(tree[name].Root, z.leftDelim, z.rightDelim))
 	}
 	return nil
 }
 
+// compile compiles a copy of the parsed templates, so that they are not
+// modified and can be zapped again.
+func (z *Zapper) compile() (map[string]*parse.Tree, error) {
+	tree := make(map[string]*parse.Tree, len(z.tree))
+	for k, v := range z.tree {
+		tree[k] = &parse.Tree{Name: v.Name, Root: v.Root.CopyDefine()}
+	}
+	if err := parse.Compile(tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// ZapToSet compiles all parsed templates and loads the result in a new
+// template.Set, ready to be executed. The set uses the same delimiters as
+// the zapper. The functions added using Funcs are added to the set, so they
+// must be actual functions.
+//
+// The set is not escaped: call its Escape method, or escape.EscapeTree on
+// its tree, to apply contextual HTML escaping.
+func (z *Zapper) ZapToSet() (*template.Set, error) {
+	z.init()
+	funcs := make(template.FuncMap)
+	for k, v := range z.funcs {
+		if reflect.ValueOf(v).Kind() != reflect.Func {
+			return nil, fmt.Errorf("zapper: value for %q is not a function", k)
+		}
+		funcs[k] = v
+	}
+	b := new(bytes.Buffer)
+	if err := z.Zap(b); err != nil {
+		return nil, err
+	}
+	set := new(template.Set).Delims(z.leftDelim, z.rightDelim).Funcs(funcs)
+	return set.Parse(b.String())
+}
+
 // Parsing --------------------------------------------------------------------
 
 // parse parses the given text and adds the resulting templates to the zapper.
@@ -128,6 +197,35 @@ func (z *Zapper) ParseGlob(pattern string) (*Zapper, error) {
 	return z.ParseFiles(filenames...)
 }
 
+// ParseFS parses templates from the file system fsys and adds them to the
+// zapper. It accepts a list of glob patterns, processed by fs.Glob, and each
+// must match at least one file.
+func (z *Zapper) ParseFS(fsys fs.FS, patterns ...string) (*Zapper, error) {
+	var filenames []string
+	for _, pattern := range patterns {
+		list, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(list) == 0 {
+			return nil, fmt.Errorf("zapper: pattern matches no files: %#q",
+				pattern)
+		}
+		filenames = append(filenames, list...)
+	}
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("zapper: no files named in call to ParseFS")
+	}
+	for _, filename := range filenames {
+		if b, err := fs.ReadFile(fsys, filename); err != nil {
+			return nil, err
+		} else if _, err = z.parse(string(b), filename); err != nil {
+			return nil, err
+		}
+	}
+	return z, nil
+}
+
 var builtins = map[string]interface{}{
 	"and":      true,
 	"call":     true,
@@ -6,11 +6,51 @@ package zap
 
 import (
 	"bytes"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
 	textTemplate "text/template"
 	htmlTemplate "html/template"
+
+	"code.google.com/p/sadbox/template/escape"
 )
 
+// testZap zaps the templates and checks the output of executing them with
+// the given data, both parsed by text/template and loaded by ZapToSet.
+func testZap(t *testing.T, z *Zapper, expect map[string]string, data interface{}) {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	if err := z.Zap(buf); err != nil {
+		t.Fatal(err)
+	}
+	txt, err := textTemplate.New("_").Delims(z.leftDelim, z.rightDelim).
+		Funcs(textTemplate.FuncMap(z.funcs)).Parse(buf.String())
+	if err != nil {
+		t.Fatalf("compiled templates don't parse: %s\n%s", err, buf)
+	}
+	set, err := z.ZapToSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range expect {
+		buf.Reset()
+		if err = txt.ExecuteTemplate(buf, name, data); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != value {
+			t.Errorf("%s: expected %q, got %q", name, value, buf.String())
+		}
+		out, err := set.ExecuteString(name, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != value {
+			t.Errorf("%s: ZapToSet: expected %q, got %q", name, value, out)
+		}
+	}
+}
+
 func TestBlock(t *testing.T) {
 	tpl := `
 	{{define "t1"}}foo-{{block "b1"}}t1b1-{{end}}bar{{end}}
@@ -60,3 +100,465 @@ func TestBlock(t *testing.T) {
 		}
 	}
 }
+
+func TestTemplates(t *testing.T) {
+	tpl := `
+	{{define "t1"}}foo-{{block "b1"}}t1b1-{{end}}bar{{end}}
+	{{define "t2" "t1"}}{{block "b1"}}t2b1-{{block "b2"}}t2b2-{{end}}{{end}}{{end}}
+	{{define "t4" "t2"}}{{block "b2"}}t4b2-{{end}}{{end}}
+	{{define "t3" "t2"}}{{block "b2"}}t3b2-{{end}}{{end}}
+	`
+	zapper := new(Zapper)
+	if names := zapper.Templates(); len(names) != 0 {
+		t.Errorf("expected no templates, got %v", names)
+	}
+	if _, err := zapper.Parse(tpl); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"t1", "t2", "t3", "t4"}
+	if got := zapper.Templates(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	for _, name := range want {
+		if !zapper.Lookup(name) {
+			t.Errorf("%s: not found", name)
+		}
+	}
+	for _, name := range []string{"t5", "b1", "source"} {
+		if zapper.Lookup(name) {
+			t.Errorf("%s: unexpectedly found", name)
+		}
+	}
+	// Zapping doesn't add the templates generated for blocks, and can be
+	// done again with the same result.
+	zapper, err := new(Zapper).Parse(tpl + `{{define "t5"}}{{block "b3" .}}{{end}}{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, "t5")
+	var out [2]bytes.Buffer
+	for i := range out {
+		if err := zapper.Zap(&out[i]); err != nil {
+			t.Fatal(err)
+		}
+		if got := zapper.Templates(); !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+		if zapper.Lookup("t5#b3") {
+			t.Errorf("t5#b3: unexpectedly found")
+		}
+	}
+	if !strings.Contains(out[0].String(), `{{define "t5#b3"}}`) {
+		t.Errorf("expected a template for block b3, got %q", out[0].String())
+	}
+	if out[0].String() != out[1].String() {
+		t.Errorf("expected the same output, got %q and %q", out[0].String(), out[1].String())
+	}
+}
+
+func TestZapDeterministic(t *testing.T) {
+	tpl := `
+	{{define "t1"}}foo-{{block "b1"}}t1b1-{{end}}bar{{end}}
+	{{define "t2" "t1"}}{{block "b1"}}t2b1-{{end}}{{end}}
+	{{define "t3" "t1"}}{{block "b1"}}t3b1-{{end}}{{end}}
+	{{define "t4" "t1"}}{{block "b1"}}t4b1-{{end}}{{end}}
+	`
+	var expected string
+	for i := 0; i < 10; i++ {
+		zapper, err := new(Zapper).Parse(tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		if err := zapper.Zap(buf); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			expected = buf.String()
+		} else if buf.String() != expected {
+			t.Fatalf("expected %q, got %q", expected, buf.String())
+		}
+	}
+	if !strings.HasPrefix(expected, `{{define "t1"}}`) {
+		t.Errorf("expected templates sorted by name, got %q", expected)
+	}
+}
+
+func TestInheritanceErrors(t *testing.T) {
+	tests := []struct {
+		tpl string
+		err string
+	}{
+		{
+			`{{define "t1" "t2"}}{{block "b1"}}t1b1{{end}}{{end}}
+			{{define "t2" "t1"}}{{block "b1"}}t2b1{{end}}{{end}}`,
+			"impossible recursion: t",
+		},
+		{
+			`{{define "t1" "t1"}}{{block "b1"}}t1b1{{end}}{{end}}`,
+			"impossible recursion: t1 -> t1",
+		},
+		{
+			`{{define "t1" "t0"}}{{block "b1"}}t1b1{{end}}{{end}}`,
+			`template not found: "t0"`,
+		},
+		{
+			`{{define "t1"}}{{block "body"}}t1{{end}}{{end}}
+			{{define "t2" "t1"}}{{block "bodyy"}}t2{{end}}{{end}}`,
+			`template "t2" defines block "bodyy", which is not in "t1"`,
+		},
+		{
+			// Blocks inherited from a grandparent can be overridden, but
+			// the check applies at every level.
+			`{{define "t1"}}{{block "body"}}t1{{end}}{{end}}
+			{{define "t2" "t1"}}{{block "body"}}{{block "inner"}}t2{{end}}{{end}}{{end}}
+			{{define "t3" "t2"}}{{block "body"}}t3{{end}}{{block "inner"}}t3{{end}}{{block "outer"}}t3{{end}}{{end}}`,
+			`template "t3" defines block "outer", which is not in "t2"`,
+		},
+	}
+	for _, test := range tests {
+		zapper, err := new(Zapper).Parse(test.tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = zapper.Zap(new(bytes.Buffer))
+		if err == nil {
+			t.Errorf("expected error %q, got none", test.err)
+		} else if !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("expected error %q, got %q", test.err, err)
+		}
+	}
+}
+
+func TestSharedParent(t *testing.T) {
+	tpl := `
+	{{define "t1"}}foo-{{block "b1"}}t1b1-{{end}}{{block "b2"}}t1b2-{{end}}bar{{end}}
+	{{define "t2" "t1"}}{{block "b1"}}t2b1-{{end}}{{end}}
+	{{define "t3" "t1"}}{{block "b2"}}t3b2-{{end}}{{end}}
+	{{define "t4" "t2"}}{{block "b2"}}t4b2-{{end}}{{end}}
+	`
+	expect := map[string]string{
+		"t1": "foo-t1b1-t1b2-bar",
+		"t2": "foo-t2b1-t1b2-bar",
+		"t3": "foo-t1b1-t3b2-bar",
+		"t4": "foo-t2b1-t4b2-bar",
+	}
+	zapper, err := new(Zapper).Parse(tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testZap(t, zapper, expect, nil)
+}
+
+func TestSuper(t *testing.T) {
+	tpl := `
+	{{define "t1"}}foo-{{block "b1"}}t1b1{{end}}-{{block "b2"}}t1b2{{end}}-bar{{end}}
+	{{define "t2" "t1"}}{{block "b1"}}{{super}} extra{{end}}{{end}}
+	{{define "t3" "t2"}}{{block "b1"}}[{{super}}]{{end}}{{block "b2"}}{{if true}}{{super}}{{end}}+t3b2{{end}}{{end}}
+	`
+	expect := map[string]string{
+		"t1": "foo-t1b1-t1b2-bar",
+		"t2": "foo-t1b1 extra-t1b2-bar",
+		"t3": "foo-[t1b1 extra]-t1b2+t3b2-bar",
+	}
+	zapper, err := new(Zapper).Parse(tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testZap(t, zapper, expect, nil)
+}
+
+func TestSuperWithoutParent(t *testing.T) {
+	for _, tpl := range []string{
+		`{{define "t1"}}foo-{{block "b1"}}{{super}}{{end}}{{end}}`,
+		`{{define "t1"}}foo-{{super}}{{end}}`,
+	} {
+		zapper, err := new(Zapper).Parse(tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = zapper.Zap(new(bytes.Buffer))
+		if err == nil || !strings.Contains(err.Error(), "{{super}}") {
+			t.Errorf("expected {{super}} error, got %v", err)
+		}
+	}
+}
+
+func TestZapToSet(t *testing.T) {
+	tpl := `
+	{{define "t1"}}foo-{{block "b1"}}t1b1-{{end}}{{upper .}}{{end}}
+	{{define "t2" "t1"}}{{block "b1"}}t2b1-{{block "b2"}}t2b2-{{end}}{{end}}{{end}}
+	{{define "t3" "t2"}}{{block "b2"}}t3b2-{{end}}{{end}}
+	`
+	expect := map[string]string{
+		"t1": "foo-t1b1-BAR",
+		"t2": "foo-t2b1-t2b2-BAR",
+		"t3": "foo-t2b1-t3b2-BAR",
+	}
+	zapper, err := new(Zapper).Funcs(map[string]interface{}{
+		"upper": strings.ToUpper,
+	}).Parse(tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testZap(t, zapper, expect, "bar")
+	// Values that are not functions can be used to parse, but not to
+	// execute.
+	for _, v := range []interface{}{nil, "foo"} {
+		zapper, err = new(Zapper).Funcs(map[string]interface{}{
+			"foo": v,
+		}).Parse(`{{define "t"}}{{foo}}{{end}}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = zapper.ZapToSet(); err == nil {
+			t.Errorf("%#v: expected error", v)
+		}
+	}
+}
+
+func TestZapEscapeTree(t *testing.T) {
+	tpl := `
+	{{define "base"}}<a href="{{block "url"}}/{{.}}{{end}}">{{.}}</a>{{end}}
+	{{define "page" "base"}}{{block "url"}}{{.}}{{end}}{{end}}
+	`
+	expect := map[string]string{
+		"base": `<a href="/a%20b">a b</a>`,
+		"page": `<a href="#ZgotmplZ">javascript:alert(&#34;&lt;x&gt;&#34;)</a>`,
+	}
+	data := map[string]string{
+		"base": "a b",
+		"page": `javascript:alert("<x>")`,
+	}
+	zapper, err := new(Zapper).Parse(tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := zapper.ZapToSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Tree, err = escape.EscapeTree(set.Tree); err != nil {
+		t.Fatal(err)
+	}
+	set.Funcs(escape.FuncMap)
+	buf := new(bytes.Buffer)
+	for name, value := range expect {
+		buf.Reset()
+		if err = set.Execute(buf, name, data[name]); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != value {
+			t.Errorf("%s: expected %q, got %q", name, value, buf.String())
+		}
+	}
+}
+
+func TestChildOnlyDefinesBlocks(t *testing.T) {
+	for _, tpl := range []string{
+		`{{define "t2" "t1"}}loose text{{block "b1"}}t2b1{{end}}{{end}}`,
+		`{{define "t2" "t1"}}{{block "b1"}}t2b1{{end}}{{.X}}{{end}}`,
+		`{{define "t2" "t1"}}{{if .X}}{{block "b1"}}t2b1{{end}}{{end}}{{end}}`,
+	} {
+		_, err := new(Zapper).Parse(`{{define "t1"}}{{block "b1"}}t1b1{{end}}{{end}}` + tpl)
+		if err == nil {
+			t.Errorf("%s: expected error, got none", tpl)
+		} else if !strings.Contains(err.Error(), "can only define blocks") {
+			t.Errorf("%s: unexpected error %q", tpl, err)
+		}
+	}
+	// Spaces are fine.
+	_, err := new(Zapper).Parse(`{{define "t1"}}{{block "b1"}}t1b1{{end}}{{end}}
+	{{define "t2" "t1"}}
+		{{block "b1"}}t2b1{{end}}
+	{{end}}`)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRequiredBlock(t *testing.T) {
+	base := `{{define "t1"}}foo-{{block "b1" required}}t1b1-{{end}}{{block "b2"}}t1b2-{{end}}bar{{end}}`
+	tests := []struct {
+		tpl string
+		err string
+	}{
+		// t2 doesn't override b1.
+		{`{{define "t2" "t1"}}{{block "b2"}}t2b2-{{end}}{{end}}`,
+			`template "t2" doesn't override required block "b1"`},
+		// t2 overrides b1, so t3 doesn't need to.
+		{`{{define "t2" "t1"}}{{block "b1"}}t2b1-{{end}}{{end}}
+		{{define "t3" "t2"}}{{block "b2"}}t3b2-{{end}}{{end}}`, ""},
+		// t2 marks b1 as required again for t3.
+		{`{{define "t2" "t1"}}{{block "b1" required}}t2b1-{{end}}{{end}}
+		{{define "t3" "t2"}}{{block "b2"}}t3b2-{{end}}{{end}}`,
+			`template "t3" doesn't override required block "b1"`},
+		// Required blocks nested in an overridden block are discarded.
+		{`{{define "t2" "t1"}}{{block "b1"}}{{block "b3" required}}t2b3-{{end}}{{end}}{{end}}
+		{{define "t3" "t2"}}{{block "b1"}}t3b1-{{end}}{{end}}`, ""},
+	}
+	for _, test := range tests {
+		zapper, err := new(Zapper).Parse(base + test.tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = zapper.Zap(new(bytes.Buffer))
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("unexpected error %q", err)
+		case test.err != "" && err == nil:
+			t.Errorf("expected error %q, got none", test.err)
+		case test.err != "" && err.Error() != test.err:
+			t.Errorf("expected error %q, got %q", test.err, err)
+		}
+	}
+}
+
+func TestEmptyRequiredBlock(t *testing.T) {
+	tpl := `
+	{{define "t1"}}{{block "b1" required}}{{end}}{{end}}
+	{{define "t2" "t1"}}{{block "b1"}}t2b1{{end}}{{end}}
+	{{define "t3"}}{{block "b2" .}}{{end}}{{end}}
+	`
+	zapper, err := new(Zapper).Parse(tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"t1", "t2", "t3"} {
+		if !zapper.Lookup(name) {
+			t.Errorf("%s: not found", name)
+		}
+	}
+	testZap(t, zapper, map[string]string{"t2": "t2b1"}, nil)
+	// A template that extends t1 without overriding b1 fails.
+	zapper, err = new(Zapper).Parse(tpl + `{{define "t4" "t1"}}{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `template "t4" doesn't override required block "b1"`
+	if err = zapper.Zap(new(bytes.Buffer)); err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+}
+
+func TestBlockPipeline(t *testing.T) {
+	tpl := `
+	{{define "t1"}}<{{.Title}}>{{block "body" .Page}}{{.Text}}{{end}}{{end}}
+	{{define "t2" "t1"}}{{block "body"}}[{{.Author.Name}}]{{end}}{{end}}
+	{{define "t3" "t2"}}{{block "body" .Page.Author}}({{.Name}}){{end}}{{end}}
+	{{define "t4" "t1"}}{{block "body"}}{{range .Tags}}{{block "tag" .}}#{{.}}{{end}}{{end}}{{end}}{{end}}
+	`
+	expect := map[string]string{
+		"t1": "<Zap>hello",
+		"t2": "<Zap>[Ana]",
+		"t3": "<Zap>(Ana)",
+		"t4": "<Zap>#a#b",
+	}
+	type author struct{ Name string }
+	data := map[string]interface{}{
+		"Title": "Zap",
+		"Page": map[string]interface{}{
+			"Text":   "hello",
+			"Author": author{"Ana"},
+			"Tags":   []string{"a", "b"},
+		},
+	}
+	zapper, err := new(Zapper).Parse(tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testZap(t, zapper, expect, data)
+	// Variables from outside the block are not visible inside it.
+	_, err = new(Zapper).Parse(`{{define "t1"}}{{$x := 1}}{{block "b" .}}{{$x}}{{end}}{{end}}`)
+	if err == nil {
+		t.Errorf("expected error for a variable defined outside the block")
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	base := `{{define "base"}}<{{block "content"}}{{end}}>{{end}}`
+	ns1 := `
+	{{namespace "blog.admin"}}
+	{{define "page" "base"}}{{block "content"}}{{template ".title"}}{{end}}{{end}}
+	{{define "title"}}admin{{end}}
+	`
+	ns2 := `
+	{{namespace "blog"}}
+	{{define "page" "base"}}{{block "content"}}{{template ".title"}}|{{template "blog.admin.title"}}{{end}}{{end}}
+	{{define "title"}}blog{{end}}
+	{{define "post" ".page"}}{{block "content"}}post:{{super}}{{end}}{{end}}
+	`
+	expect := map[string]string{
+		"blog.admin.page": "<admin>",
+		"blog.page":       "<blog|admin>",
+		"blog.post":       "<post:blog|admin>",
+	}
+	zapper := new(Zapper)
+	for _, text := range []string{base, ns1, ns2} {
+		if _, err := zapper.Parse(text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testZap(t, zapper, expect, nil)
+	for _, tpl := range []string{
+		`{{define "t"}}{{template ".title"}}{{end}}`,
+		`{{define "t"}}{{end}}{{namespace "a"}}`,
+		`{{namespace "a"}}{{namespace "b"}}`,
+		`{{namespace "a..b"}}`,
+		`{{namespace ""}}`,
+	} {
+		if _, err := new(Zapper).Parse(tpl); err == nil {
+			t.Errorf("%s: expected error", tpl)
+		}
+	}
+}
+
+func TestZapDelims(t *testing.T) {
+	tpl := `
+	[[define "t1"]]{{foo}}-[[block "b1"]]t1b1-[[end]][[if .]][[.]][[else]]none[[end]]-bar[[end]]
+	[[define "t2" "t1"]][[block "b1"]][[super]]t2b1-[[template "t3" "x"]]-[[end]][[end]]
+	[[define "t3"]][[.]][[with "]]"]][[.]][[end]][[end]]
+	`
+	expect := map[string]string{
+		"t1": "{{foo}}-t1b1-yes-bar",
+		"t2": "{{foo}}-t1b1-t2b1-x]]-yes-bar",
+	}
+	zapper, err := new(Zapper).Delims("[[", "]]").Parse(tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := zapper.Zap(buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "{{define") {
+		t.Fatalf("expected output with custom delimiters, got %q", buf.String())
+	}
+	testZap(t, zapper, expect, "yes")
+}
+
+func TestParseFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/base.html": {Data: []byte(
+			`{{define "base"}}<p>{{block "content"}}base{{end}}</p>{{end}}`)},
+		"templates/tutorial.html": {Data: []byte(
+			`{{define "tutorial" "base"}}{{block "content"}}tutorial{{end}}{{end}}`)},
+	}
+	if _, err := new(Zapper).ParseFS(fsys, "templates/*.txt"); err == nil {
+		t.Error("expected error for pattern matching no files, got none")
+	}
+	if _, err := new(Zapper).ParseFS(fsys); err == nil {
+		t.Error("expected error for no patterns, got none")
+	}
+	zapper, err := new(Zapper).ParseFS(fsys, "templates/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testZap(t, zapper, map[string]string{"tutorial": "<p>tutorial</p>"}, nil)
+	// Errors carry the name of the file that failed.
+	fsys["templates/bad.html"] = &fstest.MapFile{Data: []byte(`{{.X}`)}
+	_, err = new(Zapper).ParseFS(fsys, "templates/bad.html")
+	if err == nil || !strings.Contains(err.Error(), "templates/bad.html") {
+		t.Errorf("expected error naming the file, got %v", err)
+	}
+}